@@ -0,0 +1,110 @@
+package main
+
+import (
+	"strconv"
+
+	"google.golang.org/protobuf/compiler/protogen"
+)
+
+var syncPackage = protogen.GoImportPath("sync")
+
+// generateFake generates a configurable fake implementation of the service's server.
+func generateFake(p *protogen.Plugin, f *protogen.File) {
+	if len(f.Services) != 1 {
+		return
+	}
+
+	service := f.Services[0]
+	fakeName := service.GoName + "Fake"
+
+	g := p.NewGeneratedFile(f.GeneratedFilenamePrefix+".pb.goclay.fake.go", f.GoImportPath)
+	g.P("// Code generated by protoc-gen-goclay. DO NOT EDIT.")
+	g.P()
+	g.P("package ", f.GoPackageName)
+	g.P()
+	g.P("// ", fakeName, " is a fake ", service.GoName, "Server to be used in tests.")
+	g.P("// Responses of the unary methods are stubbed via Stub* and Handle* methods,")
+	g.P("// incoming requests are recorded and returned by *Calls methods.")
+	g.P("// Methods that are not stubbed return codes.Unimplemented.")
+	g.P("type ", fakeName, " struct {")
+	g.P("Unimplemented", service.GoName, "Server")
+	g.P()
+	g.P("mu ", syncPackage.Ident("Mutex"))
+	for _, method := range unaryMethods(service) {
+		g.P("handle", method.GoName, " func(", contextPackage.Ident("Context"), ", *", method.Input.GoIdent, ") (*", method.Output.GoIdent, ", error)")
+		g.P("calls", method.GoName, " []*", method.Input.GoIdent)
+	}
+	g.P("}")
+	g.P()
+	g.P("var _ ", service.GoName, "Server = (*", fakeName, ")(nil)")
+	g.P()
+	g.P("// New", fakeName, " creates new fake ", service.GoName, "Server.")
+	g.P("// Pass it to New", service.GoName, "ServiceDesc to serve it.")
+	g.P("func New", fakeName, "() *", fakeName, " {")
+	g.P("return &", fakeName, "{}")
+	g.P("}")
+	g.P()
+	g.P("// Reset drops all stubs and recorded calls.")
+	g.P("func (f *", fakeName, ") Reset() {")
+	g.P("f.mu.Lock()")
+	g.P("defer f.mu.Unlock()")
+	for _, method := range unaryMethods(service) {
+		g.P("f.handle", method.GoName, " = nil")
+		g.P("f.calls", method.GoName, " = nil")
+	}
+	g.P("}")
+	g.P()
+	for _, method := range unaryMethods(service) {
+		genFakeMethod(g, method)
+	}
+}
+
+func genFakeMethod(g *protogen.GeneratedFile, method *protogen.Method) {
+	fakeName := method.Parent.GoName + "Fake"
+
+	g.P("// Stub", method.GoName, " makes ", method.GoName, " return resp and err.")
+	g.P("func (f *", fakeName, ") Stub", method.GoName, "(resp *", method.Output.GoIdent, ", err error) *", fakeName, " {")
+	g.P("return f.Handle", method.GoName, "(func(", contextPackage.Ident("Context"), ", *", method.Input.GoIdent, ") (*", method.Output.GoIdent, ", error) {")
+	g.P("return resp, err")
+	g.P("})")
+	g.P("}")
+	g.P()
+	g.P("// Handle", method.GoName, " makes ", method.GoName, " call fn to produce the response.")
+	g.P("func (f *", fakeName, ") Handle", method.GoName, "(fn func(", contextPackage.Ident("Context"), ", *", method.Input.GoIdent, ") (*", method.Output.GoIdent, ", error)) *", fakeName, " {")
+	g.P("f.mu.Lock()")
+	g.P("defer f.mu.Unlock()")
+	g.P("f.handle", method.GoName, " = fn")
+	g.P("return f")
+	g.P("}")
+	g.P()
+	g.P("// ", method.GoName, "Calls returns requests ", method.GoName, " was called with.")
+	g.P("func (f *", fakeName, ") ", method.GoName, "Calls() []*", method.Input.GoIdent, " {")
+	g.P("f.mu.Lock()")
+	g.P("defer f.mu.Unlock()")
+	g.P("return append([]*", method.Input.GoIdent, "(nil), f.calls", method.GoName, "...)")
+	g.P("}")
+	g.P()
+	g.P("// ", method.GoName, " implements ", method.Parent.GoName, "Server.")
+	g.P("func (f *", fakeName, ") ", method.GoName, "(ctx ", contextPackage.Ident("Context"), ", in *", method.Input.GoIdent, ") (*", method.Output.GoIdent, ", error) {")
+	g.P("f.mu.Lock()")
+	g.P("f.calls", method.GoName, " = append(f.calls", method.GoName, ", in)")
+	g.P("fn := f.handle", method.GoName)
+	g.P("f.mu.Unlock()")
+	g.P("if fn == nil {")
+	g.P("return nil, ", statusPackage.Ident("Error"), "(", codesPackage.Ident("Unimplemented"), ", ",
+		strconv.Quote("method "+method.GoName+" is not stubbed"), ")")
+	g.P("}")
+	g.P("return fn(ctx, in)")
+	g.P("}")
+	g.P()
+}
+
+func unaryMethods(service *protogen.Service) []*protogen.Method {
+	var ret []*protogen.Method
+	for _, method := range service.Methods {
+		if !method.Desc.IsStreamingClient() && !method.Desc.IsStreamingServer() {
+			ret = append(ret, method)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"flag"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+
+	"google.golang.org/protobuf/compiler/protogen"
+)
+
+var (
+	genImpl    = flag.Bool("impl", false, "generate the implementation package scaffolding instead of the descriptors")
+	implImport = flag.String("impl_import", "", "Go import path of the implementation package, required by impl; "+
+		"the plugin's out must be the package's directory")
+	implPackage = flag.String("impl_package", "", "package name of the implementation, last element of impl_import by default")
+)
+
+// generateImpl generates the service's implementation package:
+// the struct embedding Unimplemented<Service>Server, its constructor
+// and a stub per method, each in its own file.
+// Existing package is parsed and only the missing declarations are
+// generated, so new methods are added as the proto grows.
+func generateImpl(p *protogen.Plugin, f *protogen.File) error {
+	if len(f.Services) != 1 {
+		return nil
+	}
+	if *implImport == "" {
+		return errors.New("impl requires impl_import, the Go import path of the implementation package")
+	}
+	pkg, err := parseImplPackage(*implImport)
+	if err != nil {
+		return err
+	}
+
+	service := f.Services[0]
+	implName := service.GoName + "Implementation"
+	importPath := protogen.GoImportPath(*implImport)
+
+	newFile := func(name string) *protogen.GeneratedFile {
+		name = pkg.freeName(name)
+		g := p.NewGeneratedFile(name, importPath)
+		g.P("// Code generated by protoc-gen-goclay, but you can (must) modify it.")
+		g.P("// source: ", f.Desc.Path())
+		g.P()
+		g.P("package ", implPackageName())
+		g.P()
+		return g
+	}
+
+	if !pkg.decls[implName] {
+		g := newFile(snakeCase(service.GoName) + ".go")
+		g.P("type ", implName, " struct {")
+		g.P(f.GoImportPath.Ident("Unimplemented" + service.GoName + "Server"))
+		g.P("}")
+		g.P()
+		g.P("// New", service.GoName, " create new ", implName)
+		g.P("func New", service.GoName, "() *", implName, " {")
+		g.P("return &", implName, "{}")
+		g.P("}")
+	}
+
+	for _, method := range service.Methods {
+		if pkg.decls[implName+"."+method.GoName] {
+			continue
+		}
+		name := snakeCase(method.GoName) + ".go"
+		if name == snakeCase(service.GoName)+".go" {
+			name = snakeCase(method.GoName) + "_method.go"
+		}
+		genImplMethod(newFile(name), method)
+	}
+	return nil
+}
+
+// existingPackage is the existing implementation package.
+type existingPackage struct {
+	// decls are the type names and the methods as "Type.Method".
+	decls map[string]bool
+	// files are the names of the package's files,
+	// including the ones generated by this run.
+	files map[string]bool
+}
+
+// parseImplPackage parses the package found by its import path the way
+// the go tool does, from the protoc's working directory.
+// The package is empty if it doesn't exist yet.
+func parseImplPackage(importPath string) (*existingPackage, error) {
+	pkg := &existingPackage{decls: map[string]bool{}, files: map[string]bool{}}
+	bp, err := build.Import(importPath, ".", build.FindOnly)
+	if err != nil {
+		return pkg, nil
+	}
+	entries, err := os.ReadDir(bp.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return pkg, nil
+		}
+		return nil, errors.Wrapf(err, "couldn't read the implementation package %v", importPath)
+	}
+
+	fset := token.NewFileSet()
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || filepath.Ext(name) != ".go" {
+			continue
+		}
+		pkg.files[name] = true
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, filepath.Join(bp.Dir, name), nil, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, errors.Wrapf(err, "couldn't parse the implementation package %v", importPath)
+		}
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					if ts, ok := spec.(*ast.TypeSpec); ok {
+						pkg.decls[ts.Name.Name] = true
+					}
+				}
+			case *ast.FuncDecl:
+				if decl.Recv != nil && len(decl.Recv.List) == 1 {
+					pkg.decls[receiverName(decl.Recv.List[0].Type)+"."+decl.Name.Name] = true
+				}
+			}
+		}
+	}
+	return pkg, nil
+}
+
+// freeName returns the file name not taken in the package, based on name,
+// and takes it.
+func (p *existingPackage) freeName(name string) string {
+	stem := strings.TrimSuffix(name, ".go")
+	for i := 2; p.files[name]; i++ {
+		name = stem + "_" + strconv.Itoa(i) + ".go"
+	}
+	p.files[name] = true
+	return name
+}
+
+// receiverName returns the type name of the method receiver's type.
+func receiverName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return receiverName(t.X)
+	case *ast.ParenExpr:
+		return receiverName(t.X)
+	case *ast.IndexExpr:
+		return receiverName(t.X)
+	case *ast.IndexListExpr:
+		return receiverName(t.X)
+	case *ast.Ident:
+		return t.Name
+	}
+	return ""
+}
+
+func genImplMethod(g *protogen.GeneratedFile, method *protogen.Method) {
+	implName := method.Parent.GoName + "Implementation"
+	in := g.QualifiedGoIdent(method.Input.GoIdent)
+	out := g.QualifiedGoIdent(method.Output.GoIdent)
+
+	var signature, ret string
+	switch {
+	case method.Desc.IsStreamingClient() && method.Desc.IsStreamingServer():
+		signature = "(stream " + g.QualifiedGoIdent(grpcPackage.Ident("BidiStreamingServer")) + "[" + in + ", " + out + "]) error"
+	case method.Desc.IsStreamingClient():
+		signature = "(stream " + g.QualifiedGoIdent(grpcPackage.Ident("ClientStreamingServer")) + "[" + in + ", " + out + "]) error"
+	case method.Desc.IsStreamingServer():
+		signature = "(req *" + in + ", stream " + g.QualifiedGoIdent(grpcPackage.Ident("ServerStreamingServer")) + "[" + out + "]) error"
+	default:
+		signature = "(ctx " + g.QualifiedGoIdent(contextPackage.Ident("Context")) + ", req *" + in + ") (*" + out + ", error)"
+		ret = "nil, "
+	}
+
+	g.P("func (i *", implName, ") ", method.GoName, signature, " {")
+	g.P("return ", ret, statusPackage.Ident("Error"), "(", codesPackage.Ident("Unimplemented"), ", ",
+		strconv.Quote("method "+method.GoName+" not implemented"), ")")
+	g.P("}")
+}
+
+func implPackageName() string {
+	if *implPackage != "" {
+		return *implPackage
+	}
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, path.Base(*implImport))
+	if name == "" || unicode.IsDigit(rune(name[0])) {
+		name = "impl" + name
+	}
+	return name
+}
+
+// snakeCase converts GoName to the file name, i.e. GetItem to get_item.
+func snakeCase(s string) string {
+	var b strings.Builder
+	runes := []rune(s)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
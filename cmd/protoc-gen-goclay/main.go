@@ -13,12 +13,16 @@ import (
 var (
 	contextPackage       = protogen.GoImportPath("context")
 	grpcPackage          = protogen.GoImportPath("google.golang.org/grpc")
+	codesPackage         = protogen.GoImportPath("google.golang.org/grpc/codes")
+	statusPackage        = protogen.GoImportPath("google.golang.org/grpc/status")
 	embedPackage         = protogen.GoImportPath("embed")
 	httptransportPackage = protogen.GoImportPath("github.com/not-for-prod/clay/transport/httptransport")
 	transportPackage     = protogen.GoImportPath("github.com/not-for-prod/clay/transport")
 	runtimePackage       = protogen.GoImportPath("github.com/grpc-ecosystem/grpc-gateway/v2/runtime")
 )
 
+var genFake = flag.Bool("fake", false, "generate configurable fake servers for tests")
+
 func main() {
 	protogen.Options{
 		ParamFunc: flag.CommandLine.Set,
@@ -30,7 +34,16 @@ func main() {
 				if !f.Generate {
 					continue
 				}
+				if *genImpl {
+					if err := generateImpl(p, f); err != nil {
+						return err
+					}
+					continue
+				}
 				generate(p, f)
+				if *genFake {
+					generateFake(p, f)
+				}
 			}
 
 			return nil
@@ -56,6 +69,10 @@ func generate(p *protogen.Plugin, f *protogen.File) {
 	g.P("//go:embed ", trimPathAndExt(f.Proto.GetName()), ".swagger.json")
 	g.P("var Swagger []byte")
 	g.P()
+	g.P("func init() {")
+	g.P(transportPackage.Ident("RegisterService"), "(", f.GoDescriptorIdent, ".Services().ByName(", strconv.Quote(string(service.Desc.Name())), "))")
+	g.P("}")
+	g.P()
 	g.P("// ", descName, " is a descriptor/registrator for the ", service.GoName, "Server.")
 	g.P("type ", descName, " struct {")
 	g.P("svc ", service.GoName, "Server")
@@ -93,14 +110,24 @@ func generate(p *protogen.Plugin, f *protogen.File) {
 	g.P("return Register", service.GoName, "HandlerServer(ctx, mux, w)")
 	g.P("}")
 	g.P()
+	g.P("// RegisterHTTPClient registers this service's HTTP handlers dispatching")
+	g.P("// calls through the gRPC connection. It implements transport.ClientServiceDesc.")
+	g.P("func(w *", descName, ") RegisterHTTPClient(")
+	g.P("ctx ", g.QualifiedGoIdent(contextPackage.Ident("Context")), ",")
+	g.P("mux *", g.QualifiedGoIdent(runtimePackage.Ident("ServeMux")), ",")
+	g.P("cc ", g.QualifiedGoIdent(grpcPackage.Ident("ClientConnInterface")), ",")
+	g.P(") error {")
+	g.P("return Register", service.GoName, "HandlerClient(ctx, mux, New", service.GoName, "Client(cc))")
+	g.P("}")
+	g.P()
 	g.P("// Wrap all http methods with interceptor support")
 	g.P()
 	// Wrapper method implementations.
-	for _, method := range service.Methods {
-		if !method.Desc.IsStreamingClient() && !method.Desc.IsStreamingServer() {
-			genServerMethod(g, method)
-		}
+	for _, method := range unaryMethods(service) {
+		genServerMethod(g, method)
 	}
+
+	genLocalClient(g, service)
 }
 
 func genServerMethod(
@@ -116,7 +143,7 @@ func genServerMethod(
 	g.P("if w.opts.UnaryInterceptor == nil { return w.svc.", method.GoName, "(ctx, in) }")
 	g.P("info := &", grpcPackage.Ident("UnaryServerInfo"), "{")
 	g.P("Server: w,")
-	g.P("FullMethod: ", strconv.Quote(fmt.Sprintf("/%s/%s", service.Desc.FullName(), method.Desc.Name())), ",")
+	g.P("FullMethod: ", strconv.Quote(fullMethodName(method)), ",")
 	g.P("}")
 	g.P("handler := func(ctx ", contextPackage.Ident("Context"), ", req interface{}) (interface{}, error) {")
 	g.P("return w.svc.", method.GoName, "(ctx, req.(*", method.Input.GoIdent, "))")
@@ -130,6 +157,73 @@ func genServerMethod(
 	g.P()
 }
 
+func genLocalClient(g *protogen.GeneratedFile, service *protogen.Service) {
+	descName := service.GoName + "ServiceDesc"
+	clientName := service.GoName + "LocalClient"
+
+	g.P("// ", clientName, " is an in-process ", service.GoName, "Client.")
+	g.P("// Calls are passed through the ", descName, "'s interceptors without a network hop.")
+	g.P("type ", clientName, " struct {")
+	g.P("desc *", descName)
+	g.P("}")
+	g.P()
+	g.P("var _ ", service.GoName, "Client = (*", clientName, ")(nil)")
+	g.P()
+	g.P("// New", clientName, " creates new in-process client for the ", descName, ".")
+	g.P("func New", clientName, "(d *", descName, ") *", clientName, " {")
+	g.P("return &", clientName, "{desc: d}")
+	g.P("}")
+	g.P()
+	for _, method := range service.Methods {
+		genLocalClientMethod(g, method)
+	}
+}
+
+func genLocalClientMethod(g *protogen.GeneratedFile, method *protogen.Method) {
+	clientName := method.Parent.GoName + "LocalClient"
+	ctxArg := "ctx " + g.QualifiedGoIdent(contextPackage.Ident("Context")) + ", "
+	inArg := "in *" + g.QualifiedGoIdent(method.Input.GoIdent) + ", "
+	optsArg := "opts ..." + g.QualifiedGoIdent(grpcPackage.Ident("CallOption"))
+	in := g.QualifiedGoIdent(method.Input.GoIdent)
+	out := g.QualifiedGoIdent(method.Output.GoIdent)
+
+	var signature string
+	switch {
+	case method.Desc.IsStreamingClient() && method.Desc.IsStreamingServer():
+		signature = "(" + ctxArg + optsArg + ") (" +
+			g.QualifiedGoIdent(grpcPackage.Ident("BidiStreamingClient")) + "[" + in + ", " + out + "], error)"
+	case method.Desc.IsStreamingClient():
+		signature = "(" + ctxArg + optsArg + ") (" +
+			g.QualifiedGoIdent(grpcPackage.Ident("ClientStreamingClient")) + "[" + in + ", " + out + "], error)"
+	case method.Desc.IsStreamingServer():
+		signature = "(" + ctxArg + inArg + optsArg + ") (" +
+			g.QualifiedGoIdent(grpcPackage.Ident("ServerStreamingClient")) + "[" + out + "], error)"
+	default:
+		signature = "(" + ctxArg + inArg + optsArg + ") (*" + out + ", error)"
+	}
+
+	g.P("func (c *", clientName, ") ", method.GoName, signature, " {")
+	if method.Desc.IsStreamingClient() || method.Desc.IsStreamingServer() {
+		g.P("return nil, ", statusPackage.Ident("Error"), "(", codesPackage.Ident("Unimplemented"),
+			", ", strconv.Quote("streaming method "+method.GoName+" is not supported by the local client"), ")")
+		g.P("}")
+		g.P()
+		return
+	}
+	g.P("ctx, call := ", transportPackage.Ident("NewLocalCall"), "(ctx, ", strconv.Quote(fullMethodName(method)), ", opts...)")
+	g.P("resp, err := c.desc.", method.GoName, "(ctx, in)")
+	g.P("if err = call.Finish(err); err != nil {")
+	g.P("return nil, err")
+	g.P("}")
+	g.P("return resp, nil")
+	g.P("}")
+	g.P()
+}
+
+func fullMethodName(method *protogen.Method) string {
+	return fmt.Sprintf("/%s/%s", method.Parent.Desc.FullName(), method.Desc.Name())
+}
+
 func trimPathAndExt(fName string) string {
 	f := filepath.Base(fName)
 	ext := filepath.Ext(f)
@@ -2,8 +2,6 @@ package sum
 
 import (
 	"context"
-	"fmt"
-	"time"
 
 	"github.com/google/uuid"
 	desc "github.com/utrack/clay/doc/example/pb"
@@ -12,15 +10,8 @@ import (
 )
 
 func (i *SummatorImplementation) Login(ctx context.Context, req *desc.LoginRequest) (*desc.LoginResponse, error) {
-	// Set cookie using gRPC metadata (Clay should handle this)
-	md := metadata.New(
-		map[string]string{
-			"set-cookie": fmt.Sprintf(
-				"%s=%s; Path=/; Max-Age=%d; HttpOnly; SameSite=Lax",
-				"summator-session", uuid.NewString(), int(24*time.Hour.Seconds()),
-			),
-		},
-	)
+	// Set cookie using gRPC metadata, see the server's MetadataRules.
+	md := metadata.Pairs("summator-session", uuid.NewString())
 
 	// Send metadata as trailer (Clay should convert this to HTTP headers)
 	err := grpc.SetHeader(ctx, md)
@@ -0,0 +1,100 @@
+package sum_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/not-for-prod/clay/server"
+	claytesting "github.com/not-for-prod/clay/testing"
+	"github.com/not-for-prod/clay/transport"
+	sum "github.com/utrack/clay/doc/example/implementation"
+	desc "github.com/utrack/clay/doc/example/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestSummatorConformance(t *testing.T) {
+	session := metadata.Pairs("summator-session", "test")
+	claytesting.Conform(t, desc.NewSummatorServiceDesc(sum.NewSummator()), []claytesting.Fixture{
+		{
+			Name:     "sum",
+			Method:   "/sumpb.Summator/Sum",
+			Request:  &desc.SumRequest{A: 1, B: &desc.NestedB{B: 2}},
+			Metadata: session,
+		},
+		{
+			Name:    "sum without session",
+			Method:  "/sumpb.Summator/Sum",
+			Request: &desc.SumRequest{A: 1, B: &desc.NestedB{B: 2}},
+		},
+		{
+			Name:     "sum of zero",
+			Method:   "/sumpb.Summator/Sum",
+			Request:  &desc.SumRequest{A: 0, B: &desc.NestedB{B: 2}},
+			Metadata: session,
+		},
+		{
+			Name:    "logout",
+			Method:  "/sumpb.Summator/Logout",
+			Request: &desc.LogoutRequest{},
+		},
+	})
+}
+
+func TestSummatorConformanceWithPrefix(t *testing.T) {
+	prefixed := transport.WithPathPrefix("/summator", desc.NewSummatorServiceDesc(sum.NewSummator()))
+	claytesting.Conform(t, prefixed, []claytesting.Fixture{
+		{
+			Name:     "sum",
+			Method:   "/sumpb.Summator/Sum",
+			Request:  &desc.SumRequest{A: 1, B: &desc.NestedB{B: 2}},
+			Metadata: metadata.Pairs("summator-session", "test"),
+		},
+	}, claytesting.WithServerOptions(server.WithPathPrefix("/api")))
+}
+
+func TestSummatorTransports(t *testing.T) {
+	env := claytesting.Start(t, desc.NewSummatorServiceDesc(sum.NewSummator()))
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "summator-session", "test")
+
+	resp, err := desc.NewSummatorClient(env.Conn).Sum(ctx, &desc.SumRequest{A: 1, B: &desc.NestedB{B: 2}})
+	if err != nil {
+		t.Fatalf("gRPC Sum failed: %v", err)
+	}
+	if resp.GetSum() != 3 {
+		t.Errorf("gRPC Sum = %v, want 3", resp.GetSum())
+	}
+
+	_, err = desc.NewSummatorClient(env.Conn).Sum(context.Background(), &desc.SumRequest{A: 1, B: &desc.NestedB{B: 2}})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("gRPC Sum without session: got %v, want Unauthenticated", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, env.URL("/v1/example/sum/1"), strings.NewReader(`{"b":2}`))
+	if err != nil {
+		t.Fatalf("couldn't create HTTP request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Grpc-Metadata-Summator-Session", "test")
+	httpResp, err := env.HTTP.Do(req)
+	if err != nil {
+		t.Fatalf("HTTP Sum failed: %v", err)
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		t.Fatalf("HTTP Sum status = %v, want 200", httpResp.StatusCode)
+	}
+	var body struct {
+		Sum string `json:"sum"`
+	}
+	if err := json.NewDecoder(httpResp.Body).Decode(&body); err != nil {
+		t.Fatalf("couldn't decode HTTP response: %v", err)
+	}
+	if body.Sum != "3" {
+		t.Errorf("HTTP Sum = %v, want 3", body.Sum)
+	}
+}
@@ -0,0 +1,105 @@
+package sum_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/not-for-prod/clay/server"
+	"github.com/not-for-prod/clay/server/middlewares/mwgrpc"
+	claytesting "github.com/not-for-prod/clay/testing"
+	sum "github.com/utrack/clay/doc/example/implementation"
+	desc "github.com/utrack/clay/doc/example/pb"
+	"google.golang.org/grpc"
+)
+
+// validationError is the field error the way protoc-gen-validate generates it.
+type validationError struct {
+	field, reason string
+}
+
+func (e validationError) Field() string  { return e.field }
+func (e validationError) Reason() string { return e.reason }
+func (e validationError) Error() string  { return e.field + ": " + e.reason }
+
+type validationErrors []error
+
+func (e validationErrors) AllErrors() []error { return e }
+func (e validationErrors) Error() string      { return "invalid SumRequest" }
+
+// validatedSumRequest is SumRequest with the generated-like ValidateAll.
+type validatedSumRequest struct {
+	*desc.SumRequest
+}
+
+func (r validatedSumRequest) ValidateAll() error {
+	var errs validationErrors
+	if r.GetA() <= 0 {
+		errs = append(errs, validationError{field: "a", reason: "value must be greater than 0"})
+	}
+	if r.GetB().GetB() <= 0 {
+		errs = append(errs, validationError{field: "b.b", reason: "value must be greater than 0"})
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+func validateSum(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if r, ok := req.(*desc.SumRequest); ok {
+		if err := mwgrpc.Validate(validatedSumRequest{r}); err != nil {
+			return nil, err
+		}
+	}
+	return handler(ctx, req)
+}
+
+func TestSummatorValidationOverHTTP(t *testing.T) {
+	env := claytesting.Start(t, desc.NewSummatorServiceDesc(sum.NewSummator()),
+		claytesting.WithServerOptions(server.WithGRPCUnaryMiddlewares(validateSum)))
+
+	req, err := http.NewRequest(http.MethodPost, env.URL("/v1/example/sum/-1"), strings.NewReader(`{"b":0}`))
+	if err != nil {
+		t.Fatalf("couldn't create HTTP request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := env.HTTP.Do(req)
+	if err != nil {
+		t.Fatalf("HTTP Sum failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("HTTP Sum status = %v, want 400", resp.StatusCode)
+	}
+
+	var body struct {
+		Code    int               `json:"code"`
+		Message string            `json:"message"`
+		Details []json.RawMessage `json:"details"`
+		Fields  []struct {
+			Field string `json:"field"`
+			Error string `json:"error"`
+		} `json:"fields"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("couldn't decode HTTP error: %v", err)
+	}
+	if body.Code != 3 || len(body.Details) != 1 {
+		t.Errorf("HTTP error = code %v, %v details; want InvalidArgument with BadRequest", body.Code, len(body.Details))
+	}
+	want := map[string]string{
+		"a":   "value must be greater than 0",
+		"b.b": "value must be greater than 0",
+	}
+	if len(body.Fields) != len(want) {
+		t.Fatalf("fields = %+v, want %v", body.Fields, want)
+	}
+	for _, f := range body.Fields {
+		if want[f.Field] != f.Error {
+			t.Errorf("field %q error = %q, want %q", f.Field, f.Error, want[f.Field])
+		}
+	}
+}
@@ -1,17 +1,16 @@
 package main
 
 import (
-	"context"
 	"net/http"
+	"time"
 
-	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"github.com/not-for-prod/clay/server"
 	"github.com/not-for-prod/clay/server/log"
 	"github.com/not-for-prod/clay/server/middlewares/mwgrpc"
+	"github.com/not-for-prod/clay/transport/httpruntime"
 	"github.com/sirupsen/logrus"
 	sum "github.com/utrack/clay/doc/example/implementation"
 	example "github.com/utrack/clay/doc/example/pb"
-	"google.golang.org/grpc/metadata"
 )
 
 func main() {
@@ -22,29 +21,17 @@ func main() {
 		12345,
 		// Recover from both HTTP and gRPC panics and use our own middleware
 		server.WithGRPCUnaryMiddlewares(mwgrpc.UnaryPanicHandler(log.Default)),
-		server.WithRuntimeServeMuxOpts(
-			// Remove runtime.MetadataHeaderPrefix for Set-Cookie headers.
-			runtime.WithOutgoingHeaderMatcher(
-				func(s string) (string, bool) {
-					if s == "set-cookie" {
-						return "set-cookie", true
-					}
-
-					return runtime.MetadataHeaderPrefix + s, false
-				},
-			),
-			// Extract Cookie data into metadata.
-			runtime.WithMetadata(
-				func(ctx context.Context, req *http.Request) metadata.MD {
-					tokenCookie, _ := req.Cookie("summator-session")
-					if tokenCookie == nil {
-						return nil // metadata.Pairs()
-					}
-
-					return metadata.Pairs("summator-session", tokenCookie.Value)
-				},
-			),
-		),
+		// Pass the session cookie as summator-session metadata both ways.
+		server.WithMetadataRules(httpruntime.MetadataRules{
+			IncomingCookies: []httpruntime.CookieRule{httpruntime.Cookie("summator-session")},
+			OutgoingCookies: []httpruntime.CookieRule{{
+				Name:     "summator-session",
+				Path:     "/",
+				MaxAge:   int((24 * time.Hour).Seconds()),
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			}},
+		}),
 	).Run(example.NewSummatorServiceDesc(service))
 	if err != nil {
 		logrus.Fatal(err)
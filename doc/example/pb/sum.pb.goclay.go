@@ -14,6 +14,10 @@ import (
 //go:embed sum.swagger.json
 var Swagger []byte
 
+func init() {
+	transport.RegisterService(File_sum_proto.Services().ByName("Summator"))
+}
+
 // SummatorServiceDesc is a descriptor/registrator for the SummatorServer.
 type SummatorServiceDesc struct {
 	svc  SummatorServer
@@ -51,6 +55,16 @@ func (w *SummatorServiceDesc) RegisterHTTP(
 	return RegisterSummatorHandlerServer(ctx, mux, w)
 }
 
+// RegisterHTTPClient registers this service's HTTP handlers dispatching
+// calls through the gRPC connection. It implements transport.ClientServiceDesc.
+func (w *SummatorServiceDesc) RegisterHTTPClient(
+	ctx context.Context,
+	mux *runtime.ServeMux,
+	cc grpc.ClientConnInterface,
+) error {
+	return RegisterSummatorHandlerClient(ctx, mux, NewSummatorClient(cc))
+}
+
 // Wrap all http methods with interceptor support
 
 func (w *SummatorServiceDesc) Login(ctx context.Context, in *LoginRequest) (*LoginResponse, error) {
@@ -106,3 +120,43 @@ func (w *SummatorServiceDesc) Sum(ctx context.Context, in *SumRequest) (*SumResp
 	}
 	return resp.(*SumResponse), err
 }
+
+// SummatorLocalClient is an in-process SummatorClient.
+// Calls are passed through the SummatorServiceDesc's interceptors without a network hop.
+type SummatorLocalClient struct {
+	desc *SummatorServiceDesc
+}
+
+var _ SummatorClient = (*SummatorLocalClient)(nil)
+
+// NewSummatorLocalClient creates new in-process client for the SummatorServiceDesc.
+func NewSummatorLocalClient(d *SummatorServiceDesc) *SummatorLocalClient {
+	return &SummatorLocalClient{desc: d}
+}
+
+func (c *SummatorLocalClient) Login(ctx context.Context, in *LoginRequest, opts ...grpc.CallOption) (*LoginResponse, error) {
+	ctx, call := transport.NewLocalCall(ctx, "/sumpb.Summator/Login", opts...)
+	resp, err := c.desc.Login(ctx, in)
+	if err = call.Finish(err); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *SummatorLocalClient) Logout(ctx context.Context, in *LogoutRequest, opts ...grpc.CallOption) (*LogoutResponse, error) {
+	ctx, call := transport.NewLocalCall(ctx, "/sumpb.Summator/Logout", opts...)
+	resp, err := c.desc.Logout(ctx, in)
+	if err = call.Finish(err); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *SummatorLocalClient) Sum(ctx context.Context, in *SumRequest, opts ...grpc.CallOption) (*SumResponse, error) {
+	ctx, call := transport.NewLocalCall(ctx, "/sumpb.Summator/Sum", opts...)
+	resp, err := c.desc.Sum(ctx, in)
+	if err = call.Finish(err); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
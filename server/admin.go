@@ -0,0 +1,27 @@
+package server
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// AdminOptions sets up the admin HTTP endpoints, i.e. the route table
+// at RoutesPath. They're served by their own listener only,
+// since they disclose the server's internals.
+type AdminOptions struct {
+	// Listener serves the endpoints.
+	Listener net.Listener
+	// Middlewares are applied to the endpoints, i.e. to require
+	// authentication.
+	Middlewares []func(http.Handler) http.Handler
+}
+
+// initAdminServer creates the HTTP server of the admin endpoints.
+func (s *Server) initAdminServer() {
+	router := chi.NewMux()
+	router.Use(s.opts.Admin.Middlewares...)
+	router.Get(RoutesPath, s.serveRoutes)
+	s.adminServer = &http.Server{Handler: router}
+}
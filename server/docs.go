@@ -0,0 +1,197 @@
+package server
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	httpSwagger "github.com/swaggo/http-swagger"
+)
+
+const (
+	// DefaultSpecPath is the default path of the Swagger spec.
+	DefaultSpecPath = "/swagger.json"
+	// DefaultUIPath is the default path of the docs UI.
+	DefaultUIPath = "/docs"
+)
+
+// DocsOptions sets up the Swagger spec and docs UI endpoints.
+type DocsOptions struct {
+	// Disabled disables both the spec and the UI.
+	Disabled bool
+	// SpecPath is the path of the spec, DefaultSpecPath if empty.
+	SpecPath string
+	// UIPath is the path of the UI, DefaultUIPath if empty.
+	UIPath string
+	// UI serves the docs, SwaggerUI if nil.
+	UI DocsUI
+	// DisableUI disables the UI only.
+	DisableUI bool
+	// Middlewares are applied to the endpoints only, i.e. to require
+	// authentication.
+	Middlewares []func(http.Handler) http.Handler
+	// Listener serves the endpoints instead of the public HTTP listener,
+	// i.e. the admin one. Server's path prefix is not applied there.
+	Listener net.Listener
+
+	// Title overrides the spec's info.title if set.
+	Title string
+	// Version overrides the spec's info.version if set.
+	Version string
+	// Servers are the URLs the API is served at. They're set as the spec's
+	// servers for OpenAPI v3, or host, schemes and basePath of the first
+	// URL for Swagger v2.
+	Servers []string
+}
+
+func (o *DocsOptions) specPath() string {
+	if o.SpecPath == "" {
+		return DefaultSpecPath
+	}
+	return "/" + strings.Trim(o.SpecPath, "/")
+}
+
+func (o *DocsOptions) uiPath() string {
+	if o.UIPath == "" {
+		return DefaultUIPath
+	}
+	return "/" + strings.Trim(o.UIPath, "/")
+}
+
+// DocsUI is the docs UI rendering the spec.
+type DocsUI interface {
+	// Handler returns the handler of the UI's page and assets
+	// mounted at uiPath, specURL is the spec's URL path.
+	Handler(uiPath, specURL string) http.Handler
+}
+
+type swaggerUI struct{}
+
+// SwaggerUI is the swagger-ui served from the assets embedded
+// by github.com/swaggo/files.
+func SwaggerUI() DocsUI {
+	return swaggerUI{}
+}
+
+func (swaggerUI) Handler(_, specURL string) http.Handler {
+	return httpSwagger.Handler(httpSwagger.URL(specURL))
+}
+
+// pageUI is the UI made of the page and the script bundle.
+type pageUI struct {
+	page       *template.Template
+	scriptName string
+	script     []byte
+}
+
+var redocPage = template.Must(template.New("redoc").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>API docs</title>
+</head>
+<body>
+<redoc spec-url="{{.SpecURL}}"></redoc>
+<script src="{{.Script}}"></script>
+</body>
+</html>
+`))
+
+var scalarPage = template.Must(template.New("scalar").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>API docs</title>
+</head>
+<body>
+<script id="api-reference" data-url="{{.SpecURL}}"></script>
+<script src="{{.Script}}"></script>
+</body>
+</html>
+`))
+
+// RedocUI is the Redoc UI served with the script, the redoc.standalone.js
+// bundle embedded by the application; no CDN is used.
+func RedocUI(script []byte) DocsUI {
+	return pageUI{page: redocPage, scriptName: "redoc.standalone.js", script: script}
+}
+
+// ScalarUI is the Scalar API reference UI served with the script,
+// the @scalar/api-reference standalone bundle embedded by the application;
+// no CDN is used.
+func ScalarUI(script []byte) DocsUI {
+	return pageUI{page: scalarPage, scriptName: "api-reference.js", script: script}
+}
+
+func (u pageUI) Handler(uiPath, specURL string) http.Handler {
+	var page bytes.Buffer
+	err := u.page.Execute(&page, struct{ SpecURL, Script string }{
+		SpecURL: specURL,
+		Script:  uiPath + "/" + u.scriptName,
+	})
+	if err != nil {
+		panic(err)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/"+u.scriptName):
+			w.Header().Set("Content-Type", "application/javascript")
+			w.Write(u.script)
+		case strings.HasSuffix(r.URL.Path, "/"), strings.HasSuffix(r.URL.Path, "/index.html"):
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write(page.Bytes())
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// registerDocs registers the spec and UI endpoints,
+// prefix is the path the router is served under.
+func (s *Server) registerDocs(router chi.Router, prefix string) {
+	o := s.opts.Docs
+	if o.Disabled {
+		return
+	}
+	router.Group(func(r chi.Router) {
+		r.Use(o.Middlewares...)
+
+		specPath := o.specPath()
+		r.Get(specPath, func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			io.Copy(w, bytes.NewReader(s.swaggerDef()))
+		})
+		if o.DisableUI {
+			return
+		}
+
+		uiPath := o.uiPath()
+		ui := o.UI
+		if ui == nil {
+			ui = SwaggerUI()
+		}
+		r.Handle(uiPath+"/*", ui.Handler(prefix+uiPath, prefix+specPath))
+		r.Get(uiPath, func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, prefix+uiPath+"/", http.StatusMovedPermanently)
+		})
+		if uiPath+DefaultSpecPath != specPath {
+			r.Get(uiPath+DefaultSpecPath, func(w http.ResponseWriter, r *http.Request) {
+				http.Redirect(w, r, prefix+specPath, http.StatusMovedPermanently)
+			})
+		}
+	})
+}
+
+// initDocsServer creates the HTTP server of the docs served
+// by their own listener.
+func (s *Server) initDocsServer() {
+	router := chi.NewMux()
+	s.registerDocs(router, "")
+	s.docsServer = &http.Server{Handler: router}
+}
@@ -0,0 +1,545 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/not-for-prod/clay/transport"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/mem"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// serviceEntry is the ServiceDesc served by the server.
+type serviceEntry struct {
+	desc transport.ServiceDesc
+	// services are the gRPC services registered by desc.
+	services []string
+	// routes are the HTTP routes of desc, see descRoutes.
+	routes  [][]transport.Route
+	removed bool
+
+	// grpcServer serves the ServiceDesc added at runtime
+	// via the in-memory conn.
+	grpcServer *grpc.Server
+	conn       *grpc.ClientConn
+}
+
+func (e *serviceEntry) stop() {
+	if e.grpcServer == nil {
+		return
+	}
+	go func() {
+		e.grpcServer.GracefulStop()
+		e.conn.Close()
+	}()
+}
+
+// dynamicServices keeps the ServiceDescs added and removed at runtime.
+//
+// gRPC server can't register services after it's started, so the added
+// ServiceDescs are served by their own gRPC servers; the main server
+// proxies the calls of unknown services to them.
+type dynamicServices struct {
+	srv      *Server
+	grpcOpts []grpc.ServerOption
+	unaryMW  grpc.UnaryServerInterceptor
+	health   *health.Server
+
+	mu      sync.RWMutex
+	entries []*serviceEntry
+	// services maps the gRPC services to the entries serving them.
+	services map[string]*serviceEntry
+
+	// gateway is a pointer, since the handler's type changes
+	// along with the prefixes of the ServiceDescs.
+	gateway atomic.Pointer[http.Handler]
+	swagger atomic.Value // []byte
+	routes  atomic.Pointer[transport.RouteTable]
+}
+
+func newDynamicServices() *dynamicServices {
+	return &dynamicServices{
+		health:   health.NewServer(),
+		services: map[string]*serviceEntry{},
+	}
+}
+
+func (d *dynamicServices) init(s *Server) error {
+	d.srv = s
+	for i, desc := range s.descs {
+		routes, err := descRoutes(s.opts.PathPrefix, s.registered[i])
+		if err != nil {
+			return err
+		}
+		e := &serviceEntry{desc: desc, services: serviceNames(s.registered[i]), routes: routes}
+		d.entries = append(d.entries, e)
+		for _, name := range e.services {
+			d.services[name] = e
+			d.health.SetServingStatus(name, healthpb.HealthCheckResponse_SERVING)
+		}
+	}
+	return d.updateDocs()
+}
+
+func (d *dynamicServices) registerHealth(g *grpc.Server) {
+	healthpb.RegisterHealthServer(g, d.health)
+}
+
+// add serves the ServiceDesc added at runtime.
+func (d *dynamicServices) add(desc transport.ServiceDesc) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, e := range d.entries {
+		if e.desc != desc {
+			continue
+		}
+		if !e.removed {
+			return errors.New("ServiceDesc is served already")
+		}
+		// ServiceDescs registered at start are still registered
+		// by the main gRPC server, they're only enabled back.
+		if e.grpcServer == nil {
+			e.removed = false
+			return d.update(e, healthpb.HealthCheckResponse_SERVING)
+		}
+	}
+
+	g := grpc.NewServer(d.grpcOpts...)
+	registered := registerDescs(g, desc)
+	names := serviceNames(registered)
+	for _, name := range names {
+		if e, ok := d.services[name]; ok && (!e.removed || e.grpcServer == nil) {
+			g.Stop()
+			return errors.Errorf("gRPC service %v is served already", name)
+		}
+	}
+
+	routes, err := descRoutes(d.srv.opts.PathPrefix, registered)
+	if err != nil {
+		g.Stop()
+		return err
+	}
+
+	if c, ok := desc.(transport.ConfigurableServiceDesc); ok && d.unaryMW != nil {
+		c.Apply(transport.WithUnaryInterceptor(d.unaryMW))
+	}
+	e := &serviceEntry{desc: desc, services: names, routes: routes, grpcServer: g}
+	lis := bufconn.Listen(inProcessBufferSize)
+	go e.grpcServer.Serve(lis)
+	conn, err := dialBufconn(lis)
+	if err == nil {
+		if err = checkBufconn(conn); err != nil {
+			conn.Close()
+		}
+	}
+	if err != nil {
+		e.grpcServer.Stop()
+		return errors.Wrap(err, "couldn't connect to the ServiceDesc's gRPC server")
+	}
+	e.conn = conn
+
+	d.entries = append(d.entries, e)
+	for _, name := range names {
+		d.services[name] = e
+	}
+	if err := d.update(e, healthpb.HealthCheckResponse_SERVING); err != nil {
+		d.entries = d.entries[:len(d.entries)-1]
+		for _, name := range names {
+			delete(d.services, name)
+		}
+		e.stop()
+		return err
+	}
+	return nil
+}
+
+// remove stops serving the ServiceDesc.
+func (d *dynamicServices) remove(desc transport.ServiceDesc) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for i, e := range d.entries {
+		if e.desc != desc || e.removed {
+			continue
+		}
+		e.removed = true
+		if err := d.update(e, healthpb.HealthCheckResponse_NOT_SERVING); err != nil {
+			e.removed = false
+			return err
+		}
+		if e.grpcServer != nil {
+			d.entries = append(d.entries[:i:i], d.entries[i+1:]...)
+			e.stop()
+		}
+		return nil
+	}
+	return errors.New("ServiceDesc is not served")
+}
+
+// update rebuilds the gateway and docs and sets
+// the entry's services health status.
+func (d *dynamicServices) update(e *serviceEntry, st healthpb.HealthCheckResponse_ServingStatus) error {
+	var descs []gatewayDesc
+	for _, e := range d.active() {
+		cc := d.srv.inProcessConn
+		if e.grpcServer != nil {
+			cc = e.conn
+		}
+		descs = append(descs, gatewayDesc{desc: e.desc, conn: cc})
+	}
+	gateway, err := d.srv.newGateway(descs)
+	if err != nil {
+		return errors.Wrap(err, "couldn't register HTTP handlers")
+	}
+	if err := d.updateDocs(); err != nil {
+		return err
+	}
+	d.setGateway(gateway)
+	for _, name := range e.services {
+		d.health.SetServingStatus(name, st)
+	}
+	return nil
+}
+
+func (d *dynamicServices) active() []*serviceEntry {
+	var ret []*serviceEntry
+	for _, e := range d.entries {
+		if !e.removed {
+			ret = append(ret, e)
+		}
+	}
+	return ret
+}
+
+func (d *dynamicServices) updateDocs() error {
+	var descs []transport.ServiceDesc
+	var descsRoutes [][]transport.Route
+	for _, e := range d.active() {
+		descs = append(descs, e.desc)
+		descsRoutes = append(descsRoutes, e.routes...)
+	}
+	def := transport.NewCompoundServiceDesc(descs...).SwaggerDef()
+	routes, err := transport.SwaggerRoutes(def)
+	if err != nil {
+		return errors.Wrap(err, "couldn't get HTTP routes")
+	}
+	d.srv.updateRoutes(descsRoutes)
+	d.swagger.Store(def)
+	d.routes.Store(transport.NewRouteTable(routes))
+	return nil
+}
+
+func (d *dynamicServices) setGateway(h http.Handler) {
+	d.gateway.Store(&h)
+}
+
+func (d *dynamicServices) swaggerDef() []byte {
+	return d.swagger.Load().([]byte)
+}
+
+func (d *dynamicServices) routeTable() *transport.RouteTable {
+	return d.routes.Load()
+}
+
+// ServeHTTP serves the requests by the current gateway.
+func (d *dynamicServices) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	(*d.gateway.Load()).ServeHTTP(w, r)
+}
+
+// lookup returns the entry serving the method's service
+// and whether the entry is removed at the moment.
+func (d *dynamicServices) lookup(fullMethod string) (e *serviceEntry, removed bool, name string) {
+	name = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.LastIndexByte(name, '/'); i >= 0 {
+		name = name[:i]
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	e = d.services[name]
+	return e, e != nil && e.removed, name
+}
+
+// serverOptions are the main gRPC server's options proxying
+// the calls of the services added at runtime.
+//
+// The proxy passes the messages through as they are, so the server's codec
+// is forced to proxyCodec; it delegates other messages to the registered
+// "proto" codec. Codecs forced via WithGRPCOpts are rejected by checkCodec.
+func (d *dynamicServices) serverOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.UnknownServiceHandler(d.proxy),
+		grpc.ForceServerCodecV2(proxyCodec{}),
+	}
+}
+
+// checkCodec fails if a codec is forced by the options,
+// since it would be overridden by the proxy's one.
+//
+// Server options are opaque, so the options are applied after the probe
+// codec to the server which is never exposed; the probe codec handles
+// the probe call unless it's overridden.
+func checkCodec(opts []grpc.ServerOption) error {
+	opts = append([]grpc.ServerOption{grpc.ForceServerCodecV2(probeCodec{})}, opts...)
+	g := grpc.NewServer(append(opts, grpc.Creds(insecure.NewCredentials()))...)
+	defer g.Stop()
+	g.RegisterService(&probeServiceDesc, nil)
+	lis := bufconn.Listen(inProcessBufferSize)
+	go g.Serve(lis)
+	cc, err := dialBufconn(lis)
+	if err != nil {
+		return errors.Wrap(err, "couldn't check gRPC server codec")
+	}
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), inProcessCheckTimeout)
+	defer cancel()
+	err = cc.Invoke(ctx, probeMethod, &codecProbe{}, &codecProbe{}, grpc.ForceCodecV2(probeCodec{}))
+	switch status.Code(err) {
+	case codes.OK:
+		return nil
+	case codes.FailedPrecondition:
+		return errors.New("gRPC codecs forced via WithGRPCOpts aren't supported with WithDynamicServices")
+	}
+	return errors.Wrap(err, "couldn't check gRPC server codec")
+}
+
+const probeMethod = "/clay.CodecProbe/Probe"
+
+var probeServiceDesc = grpc.ServiceDesc{
+	ServiceName: "clay.CodecProbe",
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "Probe",
+		Handler: func(_ interface{}, _ context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+			p := &codecProbe{}
+			if err := dec(p); err != nil || !p.decoded {
+				return nil, status.Error(codes.FailedPrecondition, "codec is forced")
+			}
+			return p, nil
+		},
+	}},
+}
+
+// codecProbe is the message of the probe call,
+// decoded is set by probeCodec only.
+type codecProbe struct {
+	decoded bool
+}
+
+type probeCodec struct{}
+
+func (probeCodec) Marshal(any) (mem.BufferSlice, error) {
+	return nil, nil
+}
+
+func (probeCodec) Unmarshal(_ mem.BufferSlice, v any) error {
+	p, ok := v.(*codecProbe)
+	if !ok {
+		return errors.Errorf("unexpected message %T", v)
+	}
+	p.decoded = true
+	return nil
+}
+
+func (probeCodec) Name() string {
+	return "clay-probe"
+}
+
+// serviceInfo returns the gRPC services served at the moment
+// by the main server g and the ServiceDescs added at runtime;
+// it's the reflection service's source of services.
+func (d *dynamicServices) serviceInfo(g *grpc.Server) map[string]grpc.ServiceInfo {
+	ret := g.GetServiceInfo()
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, e := range d.entries {
+		switch {
+		case e.removed:
+			for _, name := range e.services {
+				delete(ret, name)
+			}
+		case e.grpcServer != nil:
+			for name, info := range e.grpcServer.GetServiceInfo() {
+				ret[name] = info
+			}
+		}
+	}
+	return ret
+}
+
+// serviceInfoFunc is the reflection.ServiceInfoProvider calling the func.
+type serviceInfoFunc func() map[string]grpc.ServiceInfo
+
+func (f serviceInfoFunc) GetServiceInfo() map[string]grpc.ServiceInfo {
+	return f()
+}
+
+// unaryGuard rejects the calls of the removed services
+// registered at start.
+func (d *dynamicServices) unaryGuard(next grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if _, removed, name := d.lookup(info.FullMethod); removed {
+			return nil, removedError(name)
+		}
+		if next == nil {
+			return handler(ctx, req)
+		}
+		return next(ctx, req, info, handler)
+	}
+}
+
+// streamGuard rejects the calls of the removed services registered
+// at start; proxied calls skip the interceptors since they're
+// intercepted by the ServiceDescs' own servers.
+func (d *dynamicServices) streamGuard(next grpc.StreamServerInterceptor) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		e, removed, name := d.lookup(info.FullMethod)
+		switch {
+		case removed:
+			return removedError(name)
+		case e != nil && e.grpcServer != nil, next == nil:
+			return handler(srv, ss)
+		}
+		return next(srv, ss, info, handler)
+	}
+}
+
+func removedError(service string) error {
+	return status.Errorf(codes.Unimplemented, "service %v is removed", service)
+}
+
+// proxy passes the call of the service added at runtime to its server.
+func (d *dynamicServices) proxy(_ interface{}, ss grpc.ServerStream) error {
+	method, _ := grpc.MethodFromServerStream(ss)
+	e, removed, name := d.lookup(method)
+	switch {
+	case e == nil:
+		return status.Errorf(codes.Unimplemented, "unknown service %v", name)
+	case removed:
+		return removedError(name)
+	}
+
+	ctx, cancel := context.WithCancel(ss.Context())
+	defer cancel()
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx = metadata.NewOutgoingContext(ctx, forwardedMetadata(md))
+
+	cs, err := e.conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true, ClientStreams: true}, method,
+		grpc.ForceCodecV2(proxyCodec{}))
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for {
+			f := &frame{}
+			if err := ss.RecvMsg(f); err != nil {
+				if err == io.EOF {
+					cs.CloseSend()
+				} else {
+					cancel()
+				}
+				return
+			}
+			if err := cs.SendMsg(f); err != nil {
+				// io.EOF means the call is finished, its status
+				// is received by the loop below.
+				if err != io.EOF {
+					cancel()
+				}
+				return
+			}
+		}
+	}()
+
+	for i := 0; ; i++ {
+		f := &frame{}
+		err := cs.RecvMsg(f)
+		if i == 0 {
+			if h, hErr := cs.Header(); hErr == nil {
+				ss.SendHeader(forwardedMetadata(h))
+			}
+		}
+		if err != nil {
+			ss.SetTrailer(forwardedMetadata(cs.Trailer()))
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if err := ss.SendMsg(f); err != nil {
+			return err
+		}
+	}
+}
+
+// forwardedMetadata drops the transport's own keys from md.
+func forwardedMetadata(md metadata.MD) metadata.MD {
+	ret := metadata.MD{}
+	for k, v := range md {
+		if strings.HasPrefix(k, ":") || strings.HasPrefix(k, "grpc-") ||
+			k == "content-type" || k == "user-agent" || k == "te" {
+			continue
+		}
+		ret[k] = v
+	}
+	return ret
+}
+
+// frame is the raw message passed through by the proxy.
+type frame struct {
+	payload []byte
+}
+
+// proxyCodec is the proto codec passing frames as they are.
+type proxyCodec struct{}
+
+func (proxyCodec) Marshal(v any) (mem.BufferSlice, error) {
+	if f, ok := v.(*frame); ok {
+		return mem.BufferSlice{mem.SliceBuffer(f.payload)}, nil
+	}
+	return protoCodec().Marshal(v)
+}
+
+func (proxyCodec) Unmarshal(data mem.BufferSlice, v any) error {
+	if f, ok := v.(*frame); ok {
+		f.payload = data.Materialize()
+		return nil
+	}
+	return protoCodec().Unmarshal(data, v)
+}
+
+func (proxyCodec) Name() string {
+	return "proto"
+}
+
+func protoCodec() encoding.CodecV2 {
+	return encoding.GetCodecV2("proto")
+}
+
+// stop stops the servers of the ServiceDescs added at runtime.
+func (d *dynamicServices) stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, e := range d.entries {
+		if e.grpcServer != nil {
+			e.grpcServer.Stop()
+			e.conn.Close()
+		}
+	}
+	d.health.Shutdown()
+}
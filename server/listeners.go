@@ -7,29 +7,38 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/soheilhy/cmux"
+	"google.golang.org/grpc/test/bufconn"
 )
 
 const (
 	listenRetryWait     = 500 * time.Millisecond
 	listenRetryDuration = 10 * time.Second
+
+	inProcessBufferSize = 1 << 20
 )
 
 type listenerSet struct {
 	mainListener cmux.CMux // nil or CMux. If nil - don't listen
 	HTTP         net.Listener
 	GRPC         net.Listener
+	// InProcess is the in-memory gRPC listener of the gateway, if enabled.
+	InProcess *bufconn.Listener
 }
 
 func (s *Server) initListeners() error {
 	liSet := &listenerSet{}
 	var err error
 
-	liSet.GRPC, err = newListener(s.opts.RPCPort)
-	if err != nil {
-		return errors.Wrap(err, "couldn't create main listener")
+	if s.opts.Listener != nil {
+		liSet.GRPC = s.opts.Listener
+	} else {
+		liSet.GRPC, err = newListener(s.opts.RPCPort)
+		if err != nil {
+			return errors.Wrap(err, "couldn't create main listener")
+		}
 	}
 
-	if s.opts.RPCPort == s.opts.HTTPPort {
+	if s.opts.Listener != nil || s.opts.RPCPort == s.opts.HTTPPort {
 		mux := cmux.New(liSet.GRPC)
 		liSet.GRPC = mux.Match(cmux.HTTP2())
 		liSet.HTTP = mux.Match(cmux.Any())
@@ -41,6 +50,10 @@ func (s *Server) initListeners() error {
 		return errors.Wrap(err, "couldn't create HTTP listener")
 	}
 
+	if s.opts.InProcessGateway {
+		liSet.InProcess = bufconn.Listen(inProcessBufferSize)
+	}
+
 	s.listeners = liSet
 
 	return nil
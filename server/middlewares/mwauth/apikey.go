@@ -0,0 +1,39 @@
+package mwauth
+
+import (
+	"context"
+	"crypto/subtle"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/metadata"
+)
+
+// APIKeys returns the Authenticator checking the API key passed in
+// the metadata key (i.e. "x-api-key") against keys, mapping API keys
+// to the subjects.
+//
+// HTTP headers other than Authorization are not passed to the metadata
+// by the gateway by default; use runtime.WithIncomingHeaderMatcher to pass it.
+func APIKeys(mdKey string, keys map[string]string) Authenticator {
+	return AuthenticatorFunc(func(ctx context.Context) (*Principal, error) {
+		vals := metadata.ValueFromIncomingContext(ctx, mdKey)
+		if len(vals) == 0 {
+			return nil, ErrNoCredentials
+		}
+		got := []byte(vals[0])
+
+		subject, found := "", false
+		for key, sub := range keys {
+			if subtle.ConstantTimeCompare(got, []byte(key)) == 1 {
+				subject, found = sub, true
+			}
+		}
+		if !found {
+			return nil, errors.New("bad API key")
+		}
+		return &Principal{
+			Subject:       subject,
+			Authenticator: "apikey",
+		}, nil
+	})
+}
@@ -0,0 +1,215 @@
+package mwauth
+
+import (
+	"context"
+	"crypto/x509"
+
+	"github.com/not-for-prod/clay/transport/httptransport"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrNoCredentials is returned by Authenticators if the call carries
+// no credentials they can check. Next Authenticator is tried then.
+var ErrNoCredentials = errors.New("no credentials")
+
+// Principal is the authenticated caller.
+type Principal struct {
+	// Subject identifies the caller.
+	Subject string
+	// Authenticator is the name of the Authenticator that produced the Principal.
+	Authenticator string
+	// Scopes granted to the caller, if any.
+	Scopes []string
+	// Claims holds JWT claims, if any.
+	Claims map[string]interface{}
+	// Certificate is the client certificate, if any.
+	Certificate *x509.Certificate
+}
+
+// HasScope reports whether the scope is granted to the Principal.
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+// NewContext returns the context carrying the Principal.
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the Principal authenticated for the call.
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+// Authenticator authenticates the incoming call using its context,
+// i.e. incoming metadata or peer info.
+// It returns ErrNoCredentials if there's nothing to check.
+type Authenticator interface {
+	Authenticate(ctx context.Context) (*Principal, error)
+}
+
+// AuthenticatorFunc is the function implementing Authenticator.
+type AuthenticatorFunc func(ctx context.Context) (*Principal, error)
+
+// Authenticate implements Authenticator.
+func (f AuthenticatorFunc) Authenticate(ctx context.Context) (*Principal, error) {
+	return f(ctx)
+}
+
+// Authorizer checks whether the principal is allowed to call the method.
+// p is nil for unauthenticated calls of public methods.
+// Errors without gRPC status are reported as PermissionDenied.
+type Authorizer func(ctx context.Context, p *Principal, fullMethod string) error
+
+// Option is an optional setting of the authentication middleware.
+type Option func(*options)
+
+type options struct {
+	authenticators []Authenticator
+	public         httptransport.MethodMatcher
+	authorizers    []Authorizer
+}
+
+// WithAuthenticators sets up Authenticators to be tried in order.
+func WithAuthenticators(a ...Authenticator) Option {
+	return func(o *options) {
+		o.authenticators = append(o.authenticators, a...)
+	}
+}
+
+// WithPublicMethods allows unauthenticated calls of the methods matched by m.
+// Credentials are still checked if passed.
+func WithPublicMethods(m httptransport.MethodMatcher) Option {
+	return func(o *options) {
+		o.public = m
+	}
+}
+
+// WithAuthorizers sets up Authorizers that are called after authentication.
+func WithAuthorizers(a ...Authorizer) Option {
+	return func(o *options) {
+		o.authorizers = append(o.authorizers, a...)
+	}
+}
+
+// RequireScopes returns the Authorizer that requires all the scopes
+// for the methods matched by m.
+func RequireScopes(m httptransport.MethodMatcher, scopes ...string) Authorizer {
+	return func(_ context.Context, p *Principal, fullMethod string) error {
+		if !m(fullMethod) {
+			return nil
+		}
+		if p == nil {
+			return status.Error(codes.Unauthenticated, "authentication required")
+		}
+		for _, s := range scopes {
+			if !p.HasScope(s) {
+				return status.Errorf(codes.PermissionDenied, "scope %q required", s)
+			}
+		}
+		return nil
+	}
+}
+
+// UnaryServerInterceptor returns the unary interceptor that authenticates calls.
+func UnaryServerInterceptor(opts ...Option) grpc.UnaryServerInterceptor {
+	o := newOptions(opts)
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		ctx, err := o.authenticate(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns the stream interceptor that authenticates calls.
+func StreamServerInterceptor(opts ...Option) grpc.StreamServerInterceptor {
+	o := newOptions(opts)
+	return func(
+		srv interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		ctx, err := o.authenticate(stream.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		public: func(string) bool { return false },
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+func (o *options) authenticate(ctx context.Context, fullMethod string) (context.Context, error) {
+	var p *Principal
+	for _, a := range o.authenticators {
+		var err error
+		p, err = a.Authenticate(ctx)
+		if errors.Is(err, ErrNoCredentials) {
+			p = nil
+			continue
+		}
+		if err != nil {
+			if _, ok := status.FromError(err); ok {
+				return nil, err
+			}
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		break
+	}
+
+	if p == nil && !o.public(fullMethod) {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	for _, a := range o.authorizers {
+		if err := a(ctx, p, fullMethod); err != nil {
+			if _, ok := status.FromError(err); ok {
+				return nil, err
+			}
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+	}
+
+	if p == nil {
+		return ctx, nil
+	}
+	return NewContext(ctx, p), nil
+}
+
+// serverStream overrides the stream's context.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context implements grpc.ServerStream.
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
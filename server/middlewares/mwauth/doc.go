@@ -0,0 +1,10 @@
+/*
+Package mwauth provides authentication middlewares for gRPC servers.
+
+Interceptors run the configured Authenticators against the incoming call
+and attach the resulting Principal to the context.
+Since ServiceDesc's HTTP handlers run the same unary interceptors,
+gateway requests get the same Principal when the interceptor is
+passed to server.WithGRPCUnaryMiddlewares.
+*/
+package mwauth
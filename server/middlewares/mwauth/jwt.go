@@ -0,0 +1,378 @@
+package mwauth
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256" // register hashes for JWT algorithms
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/metadata"
+)
+
+// JWKS is a JSON Web Key Set used to verify JWT signatures.
+type JWKS struct {
+	keys []jwk
+}
+
+type jwk struct {
+	kid string
+	alg string
+	key crypto.PublicKey
+}
+
+type rawJWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// LoadJWKSFile reads the JWKS from a local JSON file.
+func LoadJWKSFile(path string) (*JWKS, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't read JWKS file")
+	}
+	return ParseJWKS(buf)
+}
+
+// ParseJWKS parses the JWKS JSON document.
+// RSA, EC (P-256, P-384, P-521) and OKP (Ed25519) keys are supported,
+// keys of other types and encryption keys are skipped.
+func ParseJWKS(buf []byte) (*JWKS, error) {
+	var doc struct {
+		Keys []rawJWK `json:"keys"`
+	}
+	if err := json.Unmarshal(buf, &doc); err != nil {
+		return nil, errors.Wrap(err, "couldn't unmarshal JWKS")
+	}
+
+	ret := &JWKS{}
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, errors.Wrapf(err, "bad key %q", k.Kid)
+		}
+		if key == nil {
+			continue
+		}
+		ret.keys = append(ret.keys, jwk{kid: k.Kid, alg: k.Alg, key: key})
+	}
+	return ret, nil
+}
+
+func (k rawJWK) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errors.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, errors.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("bad Ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(buf), nil
+}
+
+// JWTConfig sets up JWT claims validation.
+type JWTConfig struct {
+	// Issuer is the required "iss" claim, if set.
+	Issuer string
+	// Audience is the required "aud" claim value, if set.
+	Audience string
+	// Leeway is the allowed clock skew for "exp" and "nbf" claims.
+	Leeway time.Duration
+	// AllowMissingExp accepts tokens without the "exp" claim.
+	// The claim is required by default, so tokens never expire only
+	// if it's set explicitly.
+	AllowMissingExp bool
+	// Now returns current time, time.Now is used if nil.
+	Now func() time.Time
+}
+
+// JWT returns the Authenticator checking bearer JWTs in
+// the authorization metadata against the keys.
+// Principal's Subject is taken from the "sub" claim
+// and Scopes from the "scope" or "scp" claim.
+func JWT(keys *JWKS, cfg JWTConfig) Authenticator {
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	return AuthenticatorFunc(func(ctx context.Context) (*Principal, error) {
+		token, ok := bearerToken(ctx)
+		if !ok {
+			return nil, ErrNoCredentials
+		}
+		claims, err := keys.verify(token)
+		if err != nil {
+			return nil, errors.Wrap(err, "bad JWT")
+		}
+		if err := cfg.validate(claims); err != nil {
+			return nil, errors.Wrap(err, "bad JWT")
+		}
+		sub, _ := claims["sub"].(string)
+		return &Principal{
+			Subject:       sub,
+			Authenticator: "jwt",
+			Scopes:        claimScopes(claims),
+			Claims:        claims,
+		}, nil
+	})
+}
+
+func bearerToken(ctx context.Context) (string, bool) {
+	for _, v := range metadata.ValueFromIncomingContext(ctx, "authorization") {
+		if len(v) > 7 && strings.EqualFold(v[:7], "bearer ") {
+			return strings.TrimSpace(v[7:]), true
+		}
+	}
+	return "", false
+}
+
+func (s *JWKS) verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, errors.Wrap(err, "bad header")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.Wrap(err, "bad signature encoding")
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	verified := false
+	for _, k := range s.keys {
+		if header.Kid != "" && k.kid != header.Kid {
+			continue
+		}
+		if k.alg != "" && k.alg != header.Alg {
+			continue
+		}
+		if verifySignature(header.Alg, k.key, signed, sig) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, errors.New("signature verification failed")
+	}
+
+	claims := map[string]interface{}{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, errors.Wrap(err, "bad claims")
+	}
+	return claims, nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	buf, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed, sig []byte) bool {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "PS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "PS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "PS512", "ES512":
+		hash = crypto.SHA512
+	case "EdDSA":
+		k, ok := key.(ed25519.PublicKey)
+		return ok && ed25519.Verify(k, signed, sig)
+	default:
+		// "none" and symmetric algorithms are never accepted.
+		return false
+	}
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch alg[0] {
+	case 'R':
+		k, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(k, hash, digest, sig) == nil
+	case 'P':
+		k, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPSS(k, hash, digest, sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil
+	case 'E':
+		k, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return false
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		return ecdsa.Verify(k, digest, r, s)
+	}
+	return false
+}
+
+func (c JWTConfig) validate(claims map[string]interface{}) error {
+	now := c.Now()
+	exp, ok, err := numericClaim(claims, "exp")
+	switch {
+	case err != nil:
+		return err
+	case !ok && !c.AllowMissingExp:
+		return errors.New("token has no exp claim")
+	case ok && !now.Before(exp.Add(c.Leeway)):
+		return errors.New("token is expired")
+	}
+	nbf, ok, err := numericClaim(claims, "nbf")
+	if err != nil {
+		return err
+	}
+	if ok && now.Add(c.Leeway).Before(nbf) {
+		return errors.New("token is not valid yet")
+	}
+	if c.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != c.Issuer {
+			return errors.New("bad issuer")
+		}
+	}
+	if c.Audience != "" && !hasAudience(claims["aud"], c.Audience) {
+		return errors.New("bad audience")
+	}
+	return nil
+}
+
+// numericClaim returns the time of the NumericDate claim, if it's set.
+// Claims of other types are reported as errors.
+func numericClaim(claims map[string]interface{}, name string) (time.Time, bool, error) {
+	v, ok := claims[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	n, ok := v.(json.Number)
+	if !ok {
+		return time.Time{}, false, errors.Errorf("%v claim is not a number", name)
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false, errors.Errorf("%v claim is not a number", name)
+	}
+	if math.Abs(f) > maxNumericDate {
+		return time.Time{}, false, errors.Errorf("%v claim is out of range", name)
+	}
+	sec := math.Floor(f)
+	return time.Unix(int64(sec), int64((f-sec)*float64(time.Second))), true, nil
+}
+
+// maxNumericDate bounds the NumericDate claims, it's the end of year 9999.
+const maxNumericDate = 253402300799
+
+func hasAudience(aud interface{}, want string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == want
+	case []interface{}:
+		for _, a := range aud {
+			if a == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func claimScopes(claims map[string]interface{}) []string {
+	if s, ok := claims["scope"].(string); ok {
+		return strings.Fields(s)
+	}
+	switch scp := claims["scp"].(type) {
+	case string:
+		return strings.Fields(scp)
+	case []interface{}:
+		ret := make([]string, 0, len(scp))
+		for _, s := range scp {
+			if s, ok := s.(string); ok {
+				ret = append(ret, s)
+			}
+		}
+		return ret
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package mwauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	testRSAKey = mustRSAKey()
+	testECKey  = mustECKey()
+	testNow    = time.Unix(1700000000, 0)
+)
+
+func mustRSAKey() *rsa.PrivateKey {
+	k, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return k
+}
+
+func mustECKey() *ecdsa.PrivateKey {
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	return k
+}
+
+func b64(buf []byte) string {
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func testJWKS(t *testing.T) *JWKS {
+	t.Helper()
+	size := (testECKey.Curve.Params().BitSize + 7) / 8
+	doc := map[string]interface{}{"keys": []map[string]string{
+		{
+			"kty": "RSA",
+			"kid": "rsa",
+			"alg": "RS256",
+			"n":   b64(testRSAKey.N.Bytes()),
+			"e":   b64(big.NewInt(int64(testRSAKey.E)).Bytes()),
+		},
+		{
+			"kty": "EC",
+			"kid": "ec",
+			"crv": "P-256",
+			"x":   b64(testECKey.X.FillBytes(make([]byte, size))),
+			"y":   b64(testECKey.Y.FillBytes(make([]byte, size))),
+		},
+	}}
+	buf, _ := json.Marshal(doc)
+	keys, err := ParseJWKS(buf)
+	if err != nil {
+		t.Fatalf("ParseJWKS failed: %v", err)
+	}
+	return keys
+}
+
+// token signs the claims with the algorithm's test key,
+// signer returns the signature of the signed part.
+func token(t *testing.T, header, claims map[string]interface{}, signer func(signed []byte) []byte) string {
+	t.Helper()
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	signed := b64(h) + "." + b64(c)
+	return signed + "." + b64(signer([]byte(signed)))
+}
+
+func rs256(signed []byte) []byte {
+	digest := sha256.Sum256(signed)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, testRSAKey, crypto.SHA256, digest[:])
+	if err != nil {
+		panic(err)
+	}
+	return sig
+}
+
+func es256(signed []byte) []byte {
+	digest := sha256.Sum256(signed)
+	r, s, err := ecdsa.Sign(rand.Reader, testECKey, digest[:])
+	if err != nil {
+		panic(err)
+	}
+	return append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+}
+
+// hs256 signs with the RSA public key as the HMAC secret,
+// the algorithm confusion attack.
+func hs256(signed []byte) []byte {
+	secret := x509.MarshalPKCS1PublicKey(&testRSAKey.PublicKey)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(signed)
+	return mac.Sum(nil)
+}
+
+func none([]byte) []byte {
+	return nil
+}
+
+func validClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"sub": "user",
+		"iss": "issuer",
+		"aud": "api",
+		"exp": testNow.Add(time.Hour).Unix(),
+	}
+}
+
+func TestJWKSVerify(t *testing.T) {
+	keys := testJWKS(t)
+	tests := []struct {
+		name   string
+		header map[string]interface{}
+		signer func([]byte) []byte
+		ok     bool
+	}{
+		{"RS256", map[string]interface{}{"alg": "RS256", "kid": "rsa"}, rs256, true},
+		{"RS256 without kid", map[string]interface{}{"alg": "RS256"}, rs256, true},
+		{"ES256", map[string]interface{}{"alg": "ES256", "kid": "ec"}, es256, true},
+		{"kid mismatch", map[string]interface{}{"alg": "RS256", "kid": "ec"}, rs256, false},
+		{"unknown kid", map[string]interface{}{"alg": "RS256", "kid": "other"}, rs256, false},
+		{"alg mismatch", map[string]interface{}{"alg": "PS256", "kid": "rsa"}, rs256, false},
+		{"alg confusion", map[string]interface{}{"alg": "HS256", "kid": "rsa"}, hs256, false},
+		{"alg confusion without kid", map[string]interface{}{"alg": "HS256"}, hs256, false},
+		{"none", map[string]interface{}{"alg": "none"}, none, false},
+		{"none with kid", map[string]interface{}{"alg": "none", "kid": "rsa"}, none, false},
+		{"key of other type", map[string]interface{}{"alg": "ES256", "kid": "rsa"}, es256, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := keys.verify(token(t, tt.header, validClaims(), tt.signer))
+			if (err == nil) != tt.ok {
+				t.Errorf("verify() error = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestJWKSVerifyMalformed(t *testing.T) {
+	keys := testJWKS(t)
+	valid := token(t, map[string]interface{}{"alg": "RS256", "kid": "rsa"}, validClaims(), rs256)
+	parts := strings.Split(valid, ".")
+	tampered, _ := json.Marshal(map[string]interface{}{"sub": "admin", "exp": testNow.Add(time.Hour).Unix()})
+
+	for name, tok := range map[string]string{
+		"two segments":    parts[0] + "." + parts[1],
+		"bad signature":   parts[0] + "." + parts[1] + ".!!!",
+		"tampered claims": parts[0] + "." + b64(tampered) + "." + parts[2],
+		"empty signature": parts[0] + "." + parts[1] + ".",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := keys.verify(tok); err == nil {
+				t.Errorf("verify() accepted %v", name)
+			}
+		})
+	}
+}
+
+func TestJWTConfigValidate(t *testing.T) {
+	cfg := JWTConfig{
+		Issuer:   "issuer",
+		Audience: "api",
+		Leeway:   time.Minute,
+		Now:      func() time.Time { return testNow },
+	}
+	with := func(name string, v interface{}) map[string]interface{} {
+		c := validClaims()
+		if v == nil {
+			delete(c, name)
+		} else {
+			c[name] = v
+		}
+		return c
+	}
+	tests := []struct {
+		name   string
+		cfg    JWTConfig
+		claims map[string]interface{}
+		ok     bool
+	}{
+		{"valid", cfg, validClaims(), true},
+		{"expired", cfg, with("exp", testNow.Add(-time.Hour).Unix()), false},
+		{"expired within leeway", cfg, with("exp", testNow.Add(-30*time.Second).Unix()), true},
+		{"expired at leeway end", cfg, with("exp", testNow.Add(-time.Minute).Unix()), false},
+		{"no exp", cfg, with("exp", nil), false},
+		{"no exp allowed", JWTConfig{AllowMissingExp: true, Now: cfg.Now}, with("exp", nil), true},
+		{"string exp", cfg, with("exp", fmt.Sprint(testNow.Add(time.Hour).Unix())), false},
+		{"string exp allowed missing", JWTConfig{AllowMissingExp: true, Now: cfg.Now}, with("exp", "never"), false},
+		{"not valid yet", cfg, with("nbf", testNow.Add(time.Hour).Unix()), false},
+		{"nbf within leeway", cfg, with("nbf", testNow.Add(30*time.Second).Unix()), true},
+		{"nbf passed", cfg, with("nbf", testNow.Add(-time.Hour).Unix()), true},
+		{"string nbf", cfg, with("nbf", "soon"), false},
+		{"far future nbf", cfg, with("nbf", 1e19), false},
+		{"nbf out of range", cfg, with("nbf", 253402300800), false},
+		{"fractional nbf passed", cfg, with("nbf", float64(testNow.Unix())-0.5), true},
+		{"far future exp", cfg, with("exp", 1e19), false},
+		{"bad issuer", cfg, with("iss", "other"), false},
+		{"no issuer", cfg, with("iss", nil), false},
+		{"bad audience", cfg, with("aud", "other"), false},
+		{"no audience", cfg, with("aud", nil), false},
+		{"audience list", cfg, with("aud", []interface{}{"other", "api"}), true},
+		{"bad audience list", cfg, with("aud", []interface{}{"other"}), false},
+		{"audience not checked", JWTConfig{Now: cfg.Now}, with("aud", "other"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Claims are decoded the way verify does, numbers as json.Number.
+			buf, _ := json.Marshal(tt.claims)
+			claims := map[string]interface{}{}
+			if err := decodeSegment(b64(buf), &claims); err != nil {
+				t.Fatalf("decodeSegment failed: %v", err)
+			}
+			err := tt.cfg.validate(claims)
+			if (err == nil) != tt.ok {
+				t.Errorf("validate() error = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
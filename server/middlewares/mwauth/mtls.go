@@ -0,0 +1,32 @@
+package mwauth
+
+import (
+	"context"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// MTLS returns the Authenticator using the verified client certificate
+// of the peer. Principal's Subject is the certificate's Common Name.
+//
+// Use mwhttp.Peer middleware to make the client certificate
+// available to the HTTP handlers.
+func MTLS() Authenticator {
+	return AuthenticatorFunc(func(ctx context.Context) (*Principal, error) {
+		p, ok := peer.FromContext(ctx)
+		if !ok {
+			return nil, ErrNoCredentials
+		}
+		info, ok := p.AuthInfo.(credentials.TLSInfo)
+		if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+			return nil, ErrNoCredentials
+		}
+		cert := info.State.VerifiedChains[0][0]
+		return &Principal{
+			Subject:       cert.Subject.CommonName,
+			Authenticator: "mtls",
+			Certificate:   cert,
+		}, nil
+	})
+}
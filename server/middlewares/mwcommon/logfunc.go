@@ -2,22 +2,40 @@ package mwcommon
 
 import (
 	"context"
-	"fmt"
 	"reflect"
 
 	"github.com/not-for-prod/clay/server/log"
+	"github.com/pkg/errors"
 )
 
-func GetLogFunc(logger interface{}) func(context.Context, string) {
+// GetLogFunc returns the function writing errors to the logger.
+// The logger must implement either log.Writer or log.WriterC;
+// nil logger discards the messages.
+func GetLogFunc(logger interface{}) (func(context.Context, string), error) {
+	if logger == nil {
+		return func(context.Context, string) {}, nil
+	}
 	if logger, ok := logger.(log.Writer); ok {
 		return func(_ context.Context, s string) {
 			logger.Log(log.LevelError, s)
-		}
+		}, nil
 	}
 	if logger, ok := logger.(log.WriterC); ok {
 		return func(ctx context.Context, s string) {
 			logger.Logc(ctx, log.LevelError, s)
-		}
+		}, nil
+	}
+	return nil, errors.Errorf("unsupported logger type %v", reflect.TypeOf(logger))
+}
+
+// LogFunc is GetLogFunc falling back to log.Default if the logger is
+// of unsupported type. The misconfiguration is logged.
+func LogFunc(logger interface{}) func(context.Context, string) {
+	logFunc, err := GetLogFunc(logger)
+	if err == nil {
+		return logFunc
 	}
-	panic(fmt.Sprintf("Bad type passed to getLogFunc: %v", reflect.TypeOf(logger)))
+	log.Default.Log(log.LevelError, errors.Wrap(err, "falling back to the default logger").Error())
+	logFunc, _ = GetLogFunc(log.Default)
+	return logFunc
 }
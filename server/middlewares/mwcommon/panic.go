@@ -0,0 +1,152 @@
+package mwcommon
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/not-for-prod/clay/transport"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Panic describes the recovered panic.
+type Panic struct {
+	// Value is the value passed to panic.
+	Value interface{}
+	// Stack is the panicking goroutine's stack trace.
+	Stack []byte
+	// IncidentID identifies the panic in the logs, reports
+	// and the error returned to the client.
+	IncidentID string
+	// Method is the full gRPC method or the HTTP request's method and path.
+	Method string
+}
+
+// PanicReporter is called for every recovered panic,
+// i.e. to send it to the error tracker.
+type PanicReporter func(ctx context.Context, p Panic)
+
+// PanicOption is an optional setting of the panic handlers.
+type PanicOption func(*PanicOptions)
+
+// PanicOptions are the settings of the panic handlers.
+type PanicOptions struct {
+	// HideDetails hides the panic value from clients.
+	HideDetails bool
+	// Reporters are called for every recovered panic.
+	Reporters []PanicReporter
+	// Metric is called with the method for every recovered panic,
+	// HTTP requests are counted by their routes.
+	Metric func(method string)
+	// Routes are the routes HTTP requests are counted by.
+	Routes *transport.RouteTable
+	// NewIncidentID generates IDs of the panics.
+	NewIncidentID func() string
+}
+
+// WithHiddenPanicDetails makes the handlers return the generic
+// error message along with the incident ID, without the panic value.
+func WithHiddenPanicDetails() PanicOption {
+	return func(o *PanicOptions) {
+		o.HideDetails = true
+	}
+}
+
+// WithPanicReporters sets up the hooks called for every recovered panic.
+func WithPanicReporters(r ...PanicReporter) PanicOption {
+	return func(o *PanicOptions) {
+		o.Reporters = append(o.Reporters, r...)
+	}
+}
+
+// WithPanicMetric sets up the function counting recovered panics by method.
+func WithPanicMetric(inc func(method string)) PanicOption {
+	return func(o *PanicOptions) {
+		o.Metric = inc
+	}
+}
+
+// WithPanicRoutes sets up the routes the panics of HTTP requests are
+// counted by, see transport.DescRoutes. Requests matching none of them
+// are counted as "*", so the metric's cardinality is bounded.
+func WithPanicRoutes(routes *transport.RouteTable) PanicOption {
+	return func(o *PanicOptions) {
+		o.Routes = routes
+	}
+}
+
+// WithIncidentIDs sets up the generator of the panics' incident IDs.
+// Random 16-byte hex strings are used by default.
+func WithIncidentIDs(gen func() string) PanicOption {
+	return func(o *PanicOptions) {
+		o.NewIncidentID = gen
+	}
+}
+
+// NewPanicOptions applies the options over the defaults.
+func NewPanicOptions(opts ...PanicOption) *PanicOptions {
+	o := &PanicOptions{NewIncidentID: randomID}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+func randomID() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// Handle logs and reports the panic recovered from the method's handler.
+// It returns the Internal status error to be returned to the client.
+func (o *PanicOptions) Handle(ctx context.Context, logFunc func(context.Context, string), method string, rec interface{}) error {
+	return o.handle(ctx, logFunc, method, method, rec)
+}
+
+// HandleRequest handles the panic recovered from the HTTP request's handler
+// like Handle does. It's logged and reported with the request's method
+// and path, but counted by the request's route.
+func (o *PanicOptions) HandleRequest(ctx context.Context, logFunc func(context.Context, string), r *http.Request, rec interface{}) error {
+	route := "*"
+	if o.Routes != nil {
+		if rt, ok := o.Routes.Match(r.Method, r.URL.Path); ok {
+			route = rt.Name()
+		}
+	}
+	return o.handle(ctx, logFunc, r.Method+" "+r.URL.Path, route, rec)
+}
+
+func (o *PanicOptions) handle(ctx context.Context, logFunc func(context.Context, string), method, route string, rec interface{}) error {
+	p := Panic{
+		Value:      rec,
+		Stack:      debug.Stack(),
+		IncidentID: o.NewIncidentID(),
+		Method:     method,
+	}
+	logFunc(ctx, fmt.Sprintf("recovered from panic in %v (incident %v): %v,\n%s", method, p.IncidentID, rec, p.Stack))
+	for _, r := range o.Reporters {
+		r(ctx, p)
+	}
+	if o.Metric != nil {
+		o.Metric(route)
+	}
+
+	msg := fmt.Sprintf("panic: %v", rec)
+	if o.HideDetails {
+		msg = "internal error"
+	}
+	st, err := status.New(codes.Internal, msg+", incident ID: "+p.IncidentID).WithDetails(&errdetails.ErrorInfo{
+		Reason:   "PANIC",
+		Metadata: map[string]string{"incident_id": p.IncidentID},
+	})
+	if err != nil {
+		return status.Error(codes.Internal, msg)
+	}
+	return st.Err()
+}
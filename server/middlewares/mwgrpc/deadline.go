@@ -0,0 +1,97 @@
+package mwgrpc
+
+import (
+	"context"
+	"time"
+
+	"github.com/not-for-prod/clay/transport/httptransport"
+	"google.golang.org/grpc"
+)
+
+// Deadlines sets up deadlines of the incoming calls.
+type Deadlines struct {
+	// Default is the timeout of calls that come without a deadline.
+	// Zero means no timeout.
+	Default time.Duration
+	// Methods override the Default timeout for the matching methods.
+	// The first matching rule wins.
+	Methods []MethodTimeout
+	// Max caps the deadlines requested by clients.
+	// Zero means no cap.
+	Max time.Duration
+}
+
+// MethodTimeout is the timeout of the methods matched by Match.
+type MethodTimeout struct {
+	Match   httptransport.MethodMatcher
+	Timeout time.Duration
+}
+
+// IsZero reports whether no deadlines are set up.
+func (d Deadlines) IsZero() bool {
+	return d.Default == 0 && len(d.Methods) == 0 && d.Max == 0
+}
+
+// apply returns the context with the deadline of the method's call.
+func (d Deadlines) apply(ctx context.Context, fullMethod string) (context.Context, context.CancelFunc) {
+	if deadline, ok := ctx.Deadline(); ok {
+		if d.Max > 0 && time.Until(deadline) > d.Max {
+			return context.WithTimeout(ctx, d.Max)
+		}
+		return ctx, func() {}
+	}
+
+	timeout := d.Default
+	for _, m := range d.Methods {
+		if m.Match(fullMethod) {
+			timeout = m.Timeout
+			break
+		}
+	}
+	if d.Max > 0 && (timeout == 0 || timeout > d.Max) {
+		timeout = d.Max
+	}
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// UnaryDeadline sets up deadlines for UnaryHandlers.
+func UnaryDeadline(d Deadlines) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		ctx, cancel := d.apply(ctx, info.FullMethod)
+		defer cancel()
+		return handler(ctx, req)
+	}
+}
+
+// StreamDeadline sets up deadlines for StreamHandlers.
+func StreamDeadline(d Deadlines) grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		ctx, cancel := d.apply(stream.Context(), info.FullMethod)
+		defer cancel()
+		return handler(srv, &serverStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+// serverStream overrides the stream's context.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context implements grpc.ServerStream.
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
@@ -1,19 +1,17 @@
 package mwgrpc
 
 import (
-	"fmt"
-	"runtime/debug"
-
 	"github.com/not-for-prod/clay/server/middlewares/mwcommon"
 
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
 )
 
 // UnaryPanicHandler handles panics for UnaryHandlers.
-func UnaryPanicHandler(logger interface{}) grpc.UnaryServerInterceptor {
-	logFunc := mwcommon.GetLogFunc(logger)
+// log.Default is used if the logger is of unsupported type, see mwcommon.LogFunc.
+func UnaryPanicHandler(logger interface{}, opts ...mwcommon.PanicOption) grpc.UnaryServerInterceptor {
+	logFunc := mwcommon.LogFunc(logger)
+	o := mwcommon.NewPanicOptions(opts...)
 	return func(
 		ctx context.Context,
 		req interface{},
@@ -22,8 +20,7 @@ func UnaryPanicHandler(logger interface{}) grpc.UnaryServerInterceptor {
 	) (resp interface{}, err error) {
 		defer func() {
 			if r := recover(); r != nil {
-				err = grpc.Errorf(codes.Internal, "panic: %v", r)
-				logFunc(ctx, fmt.Sprintf("recovered from panic: %v,\n%v ", r, string(debug.Stack())))
+				err = o.Handle(ctx, logFunc, info.FullMethod, r)
 			}
 		}()
 		return handler(ctx, req)
@@ -32,8 +29,10 @@ func UnaryPanicHandler(logger interface{}) grpc.UnaryServerInterceptor {
 }
 
 // StreamPanicHandler handles panics for StreamHandlers.
-func StreamPanicHandler(logger interface{}) grpc.StreamServerInterceptor {
-	logFunc := mwcommon.GetLogFunc(logger)
+// log.Default is used if the logger is of unsupported type, see mwcommon.LogFunc.
+func StreamPanicHandler(logger interface{}, opts ...mwcommon.PanicOption) grpc.StreamServerInterceptor {
+	logFunc := mwcommon.LogFunc(logger)
+	o := mwcommon.NewPanicOptions(opts...)
 	return func(
 		srv interface{},
 		stream grpc.ServerStream,
@@ -42,8 +41,7 @@ func StreamPanicHandler(logger interface{}) grpc.StreamServerInterceptor {
 	) (err error) {
 		defer func() {
 			if r := recover(); r != nil {
-				err = grpc.Errorf(codes.Internal, "panic: %v", r)
-				logFunc(stream.Context(), fmt.Sprintf("recovered from panic: %v, %v ", r, string(debug.Stack())))
+				err = o.Handle(stream.Context(), logFunc, info.FullMethod, r)
 			}
 		}()
 
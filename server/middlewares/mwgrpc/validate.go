@@ -0,0 +1,138 @@
+package mwgrpc
+
+import (
+	"context"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type validatorAll interface {
+	ValidateAll() error
+}
+
+type validator interface {
+	Validate() error
+}
+
+// fieldError is the error of a single field, as generated by protoc-gen-validate.
+type fieldError interface {
+	Field() string
+	Reason() string
+}
+
+type multiError interface {
+	AllErrors() []error
+}
+
+type causer interface {
+	Cause() error
+}
+
+// UnaryValidator validates the requests having ValidateAll() error
+// or Validate() error methods, i.e. generated by protoc-gen-validate.
+// ValidateAll is preferred to report every violation at once.
+// Failures are returned as InvalidArgument with BadRequest details
+// listing the field violations.
+func UnaryValidator() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		if err := Validate(req); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamValidator validates the messages received by stream handlers
+// the same way UnaryValidator does.
+func StreamValidator() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		return handler(srv, &validatingStream{ServerStream: stream})
+	}
+}
+
+type validatingStream struct {
+	grpc.ServerStream
+}
+
+func (s *validatingStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return Validate(m)
+}
+
+// Validate validates the message if it has validation methods.
+// It returns nil if the message is valid or can't be validated.
+func Validate(msg interface{}) error {
+	var err error
+	switch v := msg.(type) {
+	case validatorAll:
+		err = v.ValidateAll()
+	case validator:
+		err = v.Validate()
+	default:
+		return nil
+	}
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	br := &errdetails.BadRequest{}
+	appendViolations(br, "", err)
+	st, dErr := status.New(codes.InvalidArgument, err.Error()).WithDetails(br)
+	if dErr != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return st.Err()
+}
+
+// appendViolations flattens the validation errors, nested fields'
+// paths are joined with dots.
+func appendViolations(br *errdetails.BadRequest, prefix string, err error) {
+	if m, ok := err.(multiError); ok {
+		for _, e := range m.AllErrors() {
+			appendViolations(br, prefix, e)
+		}
+		return
+	}
+	fe, ok := err.(fieldError)
+	if !ok {
+		br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       prefix,
+			Description: err.Error(),
+		})
+		return
+	}
+
+	field := fe.Field()
+	if prefix != "" {
+		field = prefix + "." + field
+	}
+	if c, ok := err.(causer); ok && c.Cause() != nil {
+		switch c.Cause().(type) {
+		case fieldError, multiError:
+			appendViolations(br, field, c.Cause())
+			return
+		}
+	}
+	br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{
+		Field:       field,
+		Description: fe.Reason(),
+	})
+}
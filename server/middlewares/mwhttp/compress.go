@@ -0,0 +1,358 @@
+package mwhttp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/not-for-prod/clay/transport/compression"
+)
+
+// DefaultCompressMinSize is the default size of the response
+// since which it is compressed.
+const DefaultCompressMinSize = 1024
+
+// DefaultMaxDecompressedSize is the default limit of the decompressed
+// request body size.
+const DefaultMaxDecompressedSize = 32 << 20
+
+// DefaultCompressContentTypes are the response types compressed by default.
+var DefaultCompressContentTypes = []string{
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"application/yaml",
+	"text/*",
+}
+
+// CompressOptions sets up the response compression.
+type CompressOptions struct {
+	// Codecs are the content codings in the order of the server's preference.
+	// compression.DefaultCodecs are used if empty.
+	Codecs []compression.Codec
+	// MinSize is the response size since which it is compressed.
+	// DefaultCompressMinSize is used if zero.
+	MinSize int
+	// ContentTypes are the compressed response types, "text/*" matches
+	// every subtype. DefaultCompressContentTypes are used if empty.
+	ContentTypes []string
+	// MaxDecompressedSize limits the size of the decompressed request body,
+	// larger requests are rejected with 413 Request Entity Too Large.
+	// DefaultMaxDecompressedSize is used if zero, negative disables the limit.
+	MaxDecompressedSize int64
+}
+
+func (o CompressOptions) withDefaults() CompressOptions {
+	if len(o.Codecs) == 0 {
+		o.Codecs = compression.DefaultCodecs
+	}
+	if o.MinSize == 0 {
+		o.MinSize = DefaultCompressMinSize
+	}
+	if len(o.ContentTypes) == 0 {
+		o.ContentTypes = DefaultCompressContentTypes
+	}
+	if o.MaxDecompressedSize == 0 {
+		o.MaxDecompressedSize = DefaultMaxDecompressedSize
+	}
+	return o
+}
+
+// Compress compresses responses using the coding negotiated
+// via the Accept-Encoding header.
+func Compress(o CompressOptions) Middleware {
+	o = o.withDefaults()
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			codec := negotiateEncoding(r.Header.Get("Accept-Encoding"), o.Codecs)
+			if codec == nil || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			cw := &compressWriter{ResponseWriter: w, opts: o, codec: codec}
+			defer cw.Close()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// Decompress decompresses request bodies sent with the Content-Encoding
+// of one of the options' codecs, so handlers get plain bodies.
+// Requests with other encodings are rejected with 415 Unsupported Media Type,
+// ones exceeding MaxDecompressedSize with 413 Request Entity Too Large.
+func Decompress(o CompressOptions) Middleware {
+	o = o.withDefaults()
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			enc := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+			if enc == "" || enc == "identity" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			codec, ok := compression.Lookup(enc, o.Codecs)
+			if !ok {
+				http.Error(w, "unsupported Content-Encoding "+strconv.Quote(enc), http.StatusUnsupportedMediaType)
+				return
+			}
+			body, err := codec.NewReader(r.Body)
+			if err != nil {
+				http.Error(w, "malformed request body: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			defer body.Close()
+
+			r = r.Clone(r.Context())
+			r.Body = body
+			r.ContentLength = -1
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			if o.MaxDecompressedSize < 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			lw := &limitWriter{ResponseWriter: w}
+			r.Body = &limitedBody{ReadCloser: http.MaxBytesReader(w, body, o.MaxDecompressedSize), w: lw}
+			next.ServeHTTP(lw, r)
+		})
+	}
+}
+
+// limitedBody marks the response when the body exceeds its limit.
+type limitedBody struct {
+	io.ReadCloser
+	w *limitWriter
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		b.w.tooLarge = true
+	}
+	return n, err
+}
+
+// limitWriter replaces the status of the response to the request
+// whose body exceeded the limit with 413 Request Entity Too Large,
+// whatever error the handler reported reading it.
+type limitWriter struct {
+	http.ResponseWriter
+	tooLarge    bool
+	wroteHeader bool
+}
+
+func (w *limitWriter) WriteHeader(code int) {
+	if !w.wroteHeader && code >= http.StatusOK {
+		w.wroteHeader = true
+		if w.tooLarge {
+			code = http.StatusRequestEntityTooLarge
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *limitWriter) Write(buf []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(buf)
+}
+
+// Flush implements http.Flusher.
+func (w *limitWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap is used by http.ResponseController.
+func (w *limitWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// negotiateEncoding picks the codec for the Accept-Encoding header value.
+// It returns nil if the response shouldn't be compressed.
+func negotiateEncoding(accept string, codecs []compression.Codec) compression.Codec {
+	if accept == "" {
+		return nil
+	}
+	weights := map[string]float64{}
+	for _, part := range strings.Split(accept, ",") {
+		name, q := parseQuality(part)
+		if name != "" {
+			weights[name] = q
+		}
+	}
+
+	var best compression.Codec
+	bestQ := 0.0
+	for _, c := range codecs {
+		q, ok := weights[c.Name()]
+		if !ok {
+			q, ok = weights["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = c, q
+		}
+	}
+	return best
+}
+
+func parseQuality(part string) (string, float64) {
+	fields := strings.Split(part, ";")
+	name := strings.ToLower(strings.TrimSpace(fields[0]))
+	q := 1.0
+	for _, f := range fields[1:] {
+		f = strings.TrimSpace(f)
+		if strings.HasPrefix(f, "q=") {
+			if v, err := strconv.ParseFloat(f[2:], 64); err == nil {
+				q = v
+			}
+		}
+	}
+	return name, q
+}
+
+// compressWriter buffers the response until it knows whether
+// to compress it, then writes it either compressed or as is.
+type compressWriter struct {
+	http.ResponseWriter
+	opts  CompressOptions
+	codec compression.Codec
+
+	code    int
+	buf     bytes.Buffer
+	decided bool
+	cw      io.WriteCloser
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.code != 0 {
+		return
+	}
+	if code < http.StatusOK {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.code = code
+	if code == http.StatusNoContent || code == http.StatusNotModified {
+		w.decide(false)
+	}
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if w.code == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.decided {
+		w.buf.Write(p)
+		if w.buf.Len() < w.opts.MinSize {
+			return len(p), nil
+		}
+		if err := w.decide(w.compressible()); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if w.cw != nil {
+		return w.cw.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush implements http.Flusher.
+// Streamed responses are compressed regardless of their size.
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		if w.code == 0 {
+			w.code = http.StatusOK
+		}
+		if err := w.decide(w.compressible()); err != nil {
+			return
+		}
+	}
+	if f, ok := w.cw.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap is used by http.ResponseController.
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Close writes out the rest of the response.
+func (w *compressWriter) Close() error {
+	if !w.decided {
+		if w.code == 0 && w.buf.Len() == 0 {
+			return nil
+		}
+		if w.code == 0 {
+			w.code = http.StatusOK
+		}
+		if err := w.decide(false); err != nil {
+			return err
+		}
+	}
+	if w.cw != nil {
+		return w.cw.Close()
+	}
+	return nil
+}
+
+func (w *compressWriter) compressible() bool {
+	h := w.Header()
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+	ct := h.Get("Content-Type")
+	if ct == "" {
+		ct = http.DetectContentType(w.buf.Bytes())
+	}
+	mediaType, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range w.opts.ContentTypes {
+		if allowed == mediaType {
+			return true
+		}
+		if strings.HasSuffix(allowed, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(allowed, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// decide writes the header and buffered data, compressing the rest if needed.
+func (w *compressWriter) decide(compress bool) error {
+	w.decided = true
+	if compress {
+		cw, err := w.codec.NewWriter(w.ResponseWriter)
+		if err == nil {
+			w.cw = cw
+			w.Header().Set("Content-Encoding", w.codec.Name())
+			w.Header().Del("Content-Length")
+		}
+	}
+	w.ResponseWriter.WriteHeader(w.code)
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	var err error
+	if w.cw != nil {
+		_, err = w.cw.Write(w.buf.Bytes())
+	} else {
+		_, err = w.ResponseWriter.Write(w.buf.Bytes())
+	}
+	w.buf.Reset()
+	return err
+}
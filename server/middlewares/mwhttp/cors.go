@@ -0,0 +1,196 @@
+package mwhttp
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// grpcMetadataPrefix is the prefix of the response headers
+// the gateway passes gRPC metadata in.
+const grpcMetadataPrefix = "Grpc-Metadata-"
+
+// CORSOptions sets up the CORS middleware.
+type CORSOptions struct {
+	// AllowedOrigins are the origins allowed to make requests.
+	// "*" allows any origin, "https://*.example.com" allows the subdomains.
+	AllowedOrigins []string
+	// AllowedMethods are the methods allowed for every path.
+	// If empty, methods are taken from RouteMethods.
+	AllowedMethods []string
+	// AllowedHeaders are the request headers allowed to be sent.
+	// If empty, headers requested by the preflight are allowed.
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers exposed to the client.
+	ExposedHeaders []string
+	// ExposeGRPCMetadata exposes every Grpc-Metadata-* response header.
+	ExposeGRPCMetadata bool
+	// AllowCredentials allows requests with credentials.
+	// It can't be combined with the "*" origin, see Validate.
+	AllowCredentials bool
+	// MaxAge is the time preflight responses can be cached for.
+	MaxAge time.Duration
+	// RouteMethods returns the methods the path is served with.
+	// Server sets it up from the ServiceDescs' routes.
+	RouteMethods func(path string) []string
+}
+
+// Validate checks the options are safe to use. Credentials can't be
+// allowed for any origin: every site could make the requests on behalf
+// of the user. Allowed origins' patterns are fine.
+func (o CORSOptions) Validate() error {
+	if !o.AllowCredentials {
+		return nil
+	}
+	for _, allowed := range o.AllowedOrigins {
+		if allowed == "*" {
+			return errors.New(`CORS credentials can't be allowed for "*" origin`)
+		}
+	}
+	return nil
+}
+
+// CORS handles Cross-Origin Resource Sharing requests.
+// It answers the preflight requests and sets up
+// the CORS headers of the actual responses.
+// It panics if the options are invalid, see CORSOptions.Validate.
+func CORS(o CORSOptions) Middleware {
+	if err := o.Validate(); err != nil {
+		panic(err)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Add("Vary", "Origin")
+			if !o.originAllowed(origin) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				if o.preflight(w, r, origin) {
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			o.setOrigin(w, origin)
+			if len(o.ExposedHeaders) > 0 {
+				w.Header().Set("Access-Control-Expose-Headers", strings.Join(o.ExposedHeaders, ", "))
+			}
+			if o.ExposeGRPCMetadata {
+				w = &exposingWriter{ResponseWriter: w, exposed: o.ExposedHeaders}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// preflight answers the preflight request.
+// It returns false if no methods are allowed for the path.
+func (o CORSOptions) preflight(w http.ResponseWriter, r *http.Request, origin string) bool {
+	methods := o.AllowedMethods
+	if len(methods) == 0 && o.RouteMethods != nil {
+		methods = o.RouteMethods(r.URL.Path)
+	}
+	if len(methods) == 0 {
+		return false
+	}
+
+	h := w.Header()
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+	o.setOrigin(w, origin)
+	h.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+	if len(o.AllowedHeaders) > 0 {
+		h.Set("Access-Control-Allow-Headers", strings.Join(o.AllowedHeaders, ", "))
+	} else if req := r.Header.Get("Access-Control-Request-Headers"); req != "" {
+		h.Set("Access-Control-Allow-Headers", req)
+	}
+	if o.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(o.MaxAge.Seconds())))
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
+
+func (o CORSOptions) setOrigin(w http.ResponseWriter, origin string) {
+	if o.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		return
+	}
+	for _, allowed := range o.AllowedOrigins {
+		if allowed == "*" {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			return
+		}
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+}
+
+func (o CORSOptions) originAllowed(origin string) bool {
+	for _, allowed := range o.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+		if i := strings.Index(allowed, "*"); i >= 0 {
+			prefix, suffix := allowed[:i], allowed[i+1:]
+			if len(origin) >= len(prefix)+len(suffix) &&
+				strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// exposingWriter exposes Grpc-Metadata-* headers set by the handler.
+type exposingWriter struct {
+	http.ResponseWriter
+	exposed     []string
+	wroteHeader bool
+}
+
+func (w *exposingWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		exposed := append([]string(nil), w.exposed...)
+		for name := range w.Header() {
+			if strings.HasPrefix(name, grpcMetadataPrefix) {
+				exposed = append(exposed, name)
+			}
+		}
+		if len(exposed) > 0 {
+			w.Header().Set("Access-Control-Expose-Headers", strings.Join(exposed, ", "))
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *exposingWriter) Write(buf []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(buf)
+}
+
+// Flush implements http.Flusher.
+func (w *exposingWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap is used by http.ResponseController.
+func (w *exposingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
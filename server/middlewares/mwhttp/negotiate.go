@@ -0,0 +1,118 @@
+package mwhttp
+
+import (
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/not-for-prod/clay/transport/httpruntime"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ContentNegotiation picks the response's MIME type among the mimes
+// marshalers are registered for, using the Accept header, and passes it
+// to the gateway as the exact Accept value.
+// JSON is always acceptable since it's the gateway's default.
+//
+// Requests that accept none of them are rejected with 406 Not Acceptable,
+// requests with bodies of other types with 415 Unsupported Media Type.
+func ContentNegotiation(mimes ...string) Middleware {
+	known := map[string]bool{httpruntime.MIMEJSON: true}
+	for _, m := range mimes {
+		known[m] = true
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ct := r.Header.Get("Content-Type"); ct != "" && hasBody(r) {
+				mediaType, _, err := mime.ParseMediaType(ct)
+				if err != nil || !known[mediaType] {
+					httpruntime.WriteStatus(w, http.StatusUnsupportedMediaType, status.Newf(
+						codes.InvalidArgument, "unsupported Content-Type %q", ct,
+					))
+					return
+				}
+				if mediaType != ct {
+					r.Header.Set("Content-Type", mediaType)
+				}
+			}
+
+			accept := r.Header.Get("Accept")
+			if accept == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			chosen, ok := negotiateMIME(accept, mimes)
+			if !ok {
+				httpruntime.WriteStatus(w, http.StatusNotAcceptable, status.Newf(
+					codes.InvalidArgument, "none of the accepted types %q is supported", accept,
+				))
+				return
+			}
+			if chosen == "" {
+				r.Header.Del("Accept")
+			} else {
+				r.Header.Set("Accept", chosen)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func hasBody(r *http.Request) bool {
+	return r.ContentLength != 0 && r.Body != nil && r.Body != http.NoBody
+}
+
+type mediaRange struct {
+	typ string
+	q   float64
+}
+
+// negotiateMIME returns the registered MIME type most preferred by
+// the Accept header. Empty MIME type means the default marshaler fits.
+func negotiateMIME(accept string, mimes []string) (string, bool) {
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, mediaRange{typ: mediaType, q: q})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].q > ranges[j].q
+	})
+
+	for _, rng := range ranges {
+		if rng.typ == "*/*" {
+			return "", true
+		}
+		for _, m := range mimes {
+			if rng.typ == m {
+				return m, true
+			}
+		}
+		if rng.typ == httpruntime.MIMEJSON || rng.typ == "application/*" {
+			return "", true
+		}
+		if strings.HasSuffix(rng.typ, "/*") {
+			prefix := strings.TrimSuffix(rng.typ, "*")
+			for _, m := range mimes {
+				if strings.HasPrefix(m, prefix) {
+					return m, true
+				}
+			}
+		}
+	}
+	return "", false
+}
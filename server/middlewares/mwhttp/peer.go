@@ -0,0 +1,47 @@
+package mwhttp
+
+import (
+	"net"
+	"net/http"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// Peer attaches the gRPC peer info to the request's context,
+// so HTTP calls' handlers and interceptors can use peer.FromContext
+// to get the client's address and TLS state.
+func Peer() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(peer.NewContext(r.Context(), RequestPeer(r))))
+		})
+	}
+}
+
+// RequestPeer returns the gRPC peer info of the HTTP request's client.
+func RequestPeer(r *http.Request) *peer.Peer {
+	p := &peer.Peer{
+		Addr: remoteAddr(r.RemoteAddr),
+	}
+	if r.TLS != nil {
+		p.AuthInfo = credentials.TLSInfo{
+			State:          *r.TLS,
+			CommonAuthInfo: credentials.CommonAuthInfo{SecurityLevel: credentials.PrivacyAndIntegrity},
+		}
+	}
+	return p
+}
+
+func remoteAddr(addr string) net.Addr {
+	if tcpAddr, err := net.ResolveTCPAddr("tcp", addr); err == nil {
+		return tcpAddr
+	}
+	return strAddr(addr)
+}
+
+// strAddr is the net.Addr of an unresolvable address.
+type strAddr string
+
+func (a strAddr) Network() string { return "tcp" }
+func (a strAddr) String() string  { return string(a) }
@@ -2,32 +2,106 @@ package mwhttp
 
 import (
 	"fmt"
+	"mime"
 	"net/http"
-	"runtime/debug"
+	"strconv"
 
 	"github.com/not-for-prod/clay/server/middlewares/mwcommon"
 	"github.com/not-for-prod/clay/transport/httpruntime"
-
-	"github.com/pkg/errors"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
 )
 
 // Recover recovers HTTP server from handlers' panics.
-func Recover(logger interface{}) Middleware {
-	logFunc := mwcommon.GetLogFunc(logger)
+// log.Default is used if the logger is of unsupported type, see mwcommon.LogFunc.
+// Panics are counted by the requests' routes, see mwcommon.WithPanicRoutes.
+//
+// The error is written as usual unless the handler has written the
+// response's header already. Streamed (flushed) responses are finished
+// with the error event for text/event-stream or the {"error": ...}
+// line otherwise, plus the Grpc-Status and Grpc-Message trailers;
+// connections of other partially written responses are aborted.
+// http.ErrAbortHandler panics are passed through.
+func Recover(logger interface{}, opts ...mwcommon.PanicOption) Middleware {
+	logFunc := mwcommon.LogFunc(logger)
+	o := mwcommon.NewPanicOptions(opts...)
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tw := &trackingWriter{ResponseWriter: w}
 			defer func() {
-				if rec := recover(); rec != nil {
-					stack := string(debug.Stack())
-					httpruntime.SetError(
-						r.Context(),
-						r, w,
-						errors.Errorf("recovered from panic: %v\nstack:%v", rec, stack),
-					)
-					logFunc(r.Context(), fmt.Sprintf("recovered from panic: %v, %v ", rec, stack))
+				rec := recover()
+				if rec == nil {
+					return
+				}
+				if rec == http.ErrAbortHandler {
+					panic(rec)
+				}
+				err := o.HandleRequest(r.Context(), logFunc, r, rec)
+				switch {
+				case !tw.wroteHeader:
+					httpruntime.SetError(r.Context(), r, w, err)
+				case tw.flushed:
+					writeStreamError(tw, err)
+				default:
+					panic(http.ErrAbortHandler)
 				}
 			}()
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(tw, r)
 		})
 	}
 }
+
+// writeStreamError finishes the streamed response with the error.
+func writeStreamError(w *trackingWriter, err error) {
+	st := status.Convert(err)
+	buf, mErr := protojson.Marshal(st.Proto())
+	if mErr != nil {
+		buf = []byte(`{"code":13,"message":"failed to marshal error message"}`)
+	}
+
+	h := w.Header()
+	h.Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(int(st.Code())))
+	h.Set(http.TrailerPrefix+"Grpc-Message", st.Message())
+
+	mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	if mediaType == "text/event-stream" {
+		fmt.Fprintf(w, "event: error\ndata: %s\n\n", buf)
+	} else {
+		fmt.Fprintf(w, "{\"error\":%s}\n", buf)
+	}
+	w.Flush()
+}
+
+// trackingWriter tracks whether the response's header is written
+// and whether the response is streamed.
+type trackingWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+	flushed     bool
+}
+
+func (w *trackingWriter) WriteHeader(code int) {
+	if code >= http.StatusOK {
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *trackingWriter) Write(buf []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(buf)
+}
+
+// Flush implements http.Flusher.
+func (w *trackingWriter) Flush() {
+	w.wroteHeader = true
+	w.flushed = true
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap is used by http.ResponseController.
+func (w *trackingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,42 @@
+package mwhttp
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RequestTimeoutHeader is the HTTP header clients can pass the request's
+// timeout in, either as a duration ("1.5s", "300ms") or as seconds ("2").
+const RequestTimeoutHeader = "Request-Timeout"
+
+// RequestTimeout sets the request context's deadline from
+// the Request-Timeout header.
+// Malformed and non-positive values are ignored.
+func RequestTimeout() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			timeout, ok := parseTimeout(r.Header.Get(RequestTimeoutHeader))
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func parseTimeout(s string) (time.Duration, bool) {
+	if s == "" {
+		return 0, false
+	}
+	if secs, err := strconv.ParseFloat(s, 64); err == nil {
+		d := time.Duration(secs * float64(time.Second))
+		return d, d > 0
+	}
+	d, err := time.ParseDuration(s)
+	return d, err == nil && d > 0
+}
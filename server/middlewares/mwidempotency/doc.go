@@ -0,0 +1,30 @@
+/*
+Package mwidempotency makes retried calls safe to repeat.
+
+Clients pass the same idempotency key with every retry of a call, in the
+Idempotency-Key HTTP header or the idempotency-key gRPC metadata.
+The first call's response, error and metadata are stored and replayed
+for its duplicates, so the handler runs once per key. Duplicates arriving
+while the first call is in flight fail with codes.Aborted (409 Conflict),
+reusing a key with a different request fails with codes.InvalidArgument.
+
+Keys are scoped by the caller, see CallerScope: a key reused by another
+principal or client never replays the first caller's response. Calls
+whose caller is unknown are passed through without deduplication.
+
+The interceptor is enabled per method: either pass it to the methods via
+server.WithGRPCMethodUnaryMiddlewares, or mark the methods with a custom proto
+option and use WithMethodOption. Server's middlewares are applied to the
+ServiceDescs' HTTP handlers too, so the server option alone covers both
+transports; don't pass the interceptor to transport.WithMethodUnaryInterceptor
+as well, the nested call would see its own reservation and fail with Aborted.
+
+	srv := server.NewServer(
+		port,
+		server.WithHTTPMiddlewares(mwhttp.Peer(), mwidempotency.Middleware()),
+		server.WithGRPCUnaryMiddlewares(mwidempotency.UnaryServerInterceptor(
+			mwidempotency.WithMethodOption(billing.E_Idempotent),
+		)),
+	)
+*/
+package mwidempotency
@@ -0,0 +1,25 @@
+package mwidempotency
+
+import (
+	"net/http"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/not-for-prod/clay/server/middlewares/mwhttp"
+)
+
+// HTTPHeader is the HTTP header carrying the idempotency key.
+const HTTPHeader = "Idempotency-Key"
+
+// Middleware passes the Idempotency-Key header of POST requests
+// to the handlers as the idempotency-key gRPC metadata.
+func Middleware() mwhttp.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if key := r.Header.Get(HTTPHeader); key != "" && r.Method == http.MethodPost {
+				r.Header.Del(HTTPHeader)
+				r.Header.Set(runtime.MetadataHeaderPrefix+MetadataKey, key)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
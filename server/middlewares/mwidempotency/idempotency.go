@@ -0,0 +1,361 @@
+package mwidempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/not-for-prod/clay/server/middlewares/mwauth"
+	"github.com/not-for-prod/clay/transport"
+	"github.com/not-for-prod/clay/transport/httptransport"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// MetadataKey is the gRPC metadata key carrying the idempotency key.
+const MetadataKey = "idempotency-key"
+
+// ReplayedKey is the header metadata key set to "true"
+// for the replayed responses.
+const ReplayedKey = "idempotent-replayed"
+
+// DefaultTTL is the default time the calls' records are kept for.
+const DefaultTTL = 24 * time.Hour
+
+// DefaultLease is the default time the key is reserved for the call
+// in flight. It's extended to the call's deadline if that is later.
+const DefaultLease = time.Minute
+
+// Option is an optional setting of the interceptor.
+type Option func(*options)
+
+type options struct {
+	store   Store
+	ttl     time.Duration
+	lease   time.Duration
+	scope   func(ctx context.Context) string
+	match   httptransport.MethodMatcher
+	options []protoreflect.ExtensionType
+}
+
+// WithStore sets the Store keeping the calls' records.
+// MemoryStore is used by default.
+func WithStore(s Store) Option {
+	return func(o *options) {
+		o.store = s
+	}
+}
+
+// WithTTL sets the time the calls' records are kept for, DefaultTTL by default.
+func WithTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.ttl = ttl
+	}
+}
+
+// WithLease sets the time the key is reserved for the call in flight,
+// DefaultLease by default. The reservation is released when the call
+// completes; the lease only bounds it if the process dies mid-call.
+func WithLease(lease time.Duration) Option {
+	return func(o *options) {
+		o.lease = lease
+	}
+}
+
+// WithScope sets the way the keys of different callers are separated,
+// CallerScope by default. Calls of the empty scope are passed through
+// without deduplication, since their callers can't be told apart.
+func WithScope(scope func(ctx context.Context) string) Option {
+	return func(o *options) {
+		o.scope = scope
+	}
+}
+
+// WithMethods enables the interceptor for the methods matched by m.
+func WithMethods(m httptransport.MethodMatcher) Option {
+	return func(o *options) {
+		o.match = m
+	}
+}
+
+// WithMethodOption enables the interceptor for the methods having
+// the custom proto option xt set; boolean options must be true.
+func WithMethodOption(xt protoreflect.ExtensionType) Option {
+	return func(o *options) {
+		o.options = append(o.options, xt)
+	}
+}
+
+// enabled reports whether the method is idempotent.
+// Every method is if neither WithMethods nor WithMethodOption is used.
+func (o *options) enabled(fullMethod string) bool {
+	if o.match == nil && len(o.options) == 0 {
+		return true
+	}
+	if o.match != nil && o.match(fullMethod) {
+		return true
+	}
+	m, ok := transport.LookupMethod(fullMethod)
+	if !ok {
+		return false
+	}
+	for _, xt := range o.options {
+		if !m.HasOption(xt) {
+			continue
+		}
+		if v, ok := m.Option(xt).(bool); !ok || v {
+			return true
+		}
+	}
+	return false
+}
+
+// UnaryServerInterceptor returns the interceptor replaying the stored
+// outcomes of the calls with the same idempotency key.
+// Calls without the key are passed through.
+//
+// Calls failed with Canceled, DeadlineExceeded, Unavailable,
+// ResourceExhausted or Aborted codes are not stored, so they
+// can be retried with the same key.
+func UnaryServerInterceptor(opts ...Option) grpc.UnaryServerInterceptor {
+	o := &options{store: NewMemoryStore(), ttl: DefaultTTL, lease: DefaultLease, scope: CallerScope}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		keys := metadata.ValueFromIncomingContext(ctx, MetadataKey)
+		if len(keys) == 0 || keys[0] == "" || !o.enabled(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		scope := o.scope(ctx)
+		if scope == "" {
+			return handler(ctx, req)
+		}
+		key := scope + "|" + info.FullMethod + "|" + keys[0]
+		fp, err := fingerprint(req)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "couldn't fingerprint request: %v", err)
+		}
+
+		rec, err := o.store.Begin(ctx, key, o.leaseFor(ctx))
+		switch {
+		case err == ErrInProgress:
+			return nil, status.Error(codes.Aborted, err.Error())
+		case err != nil:
+			return nil, status.Errorf(codes.Internal, "idempotency store failure: %v", err)
+		case rec != nil:
+			if !bytes.Equal(rec.Fingerprint, fp) {
+				return nil, status.Error(codes.InvalidArgument, "idempotency key is reused with a different request")
+			}
+			return replay(ctx, rec)
+		}
+
+		// The reservation is released unless the outcome is stored,
+		// including the handler's panics.
+		storeCtx := context.WithoutCancel(ctx)
+		completed := false
+		defer func() {
+			if !completed {
+				o.store.Release(storeCtx, key)
+			}
+		}()
+
+		stream := &recordingStream{ServerTransportStream: grpc.ServerTransportStreamFromContext(ctx)}
+		resp, err := handler(grpc.NewContextWithServerTransportStream(ctx, stream), req)
+		if retryable(err) {
+			return resp, err
+		}
+		rec, recErr := stream.record(fp, resp, err)
+		if recErr == nil {
+			recErr = o.store.Complete(storeCtx, key, rec, o.ttl)
+		}
+		completed = recErr == nil
+		return resp, err
+	}
+}
+
+// CallerScope separates the keys by the principal authenticated by mwauth,
+// or by the client's IP address for unauthenticated calls. HTTP clients'
+// addresses are known to the handlers if mwhttp.Peer middleware is used
+// and the gateway calls the implementation directly.
+// It returns the empty scope if the caller is unknown.
+func CallerScope(ctx context.Context) string {
+	if p, ok := mwauth.FromContext(ctx); ok {
+		return "principal:" + p.Authenticator + ":" + p.Subject
+	}
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil || net.ParseIP(host) == nil {
+		return ""
+	}
+	return "ip:" + host
+}
+
+// leaseFor returns the reservation time of the call.
+func (o *options) leaseFor(ctx context.Context) time.Duration {
+	lease := o.lease
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) > lease {
+		lease = time.Until(deadline)
+	}
+	return lease
+}
+
+func fingerprint(req interface{}) ([]byte, error) {
+	msg, ok := req.(proto.Message)
+	if !ok {
+		return nil, nil
+	}
+	buf, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(buf)
+	return sum[:], nil
+}
+
+func retryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Canceled, codes.DeadlineExceeded, codes.Unavailable,
+		codes.ResourceExhausted, codes.Aborted:
+		return true
+	}
+	return false
+}
+
+func replay(ctx context.Context, rec *Record) (interface{}, error) {
+	header := metadata.Join(rec.Header, metadata.Pairs(ReplayedKey, "true"))
+	if err := grpc.SetHeader(ctx, header); err != nil {
+		return nil, err
+	}
+	if len(rec.Trailer) > 0 {
+		if err := grpc.SetTrailer(ctx, rec.Trailer); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(rec.Status) > 0 {
+		st := &spb.Status{}
+		if err := proto.Unmarshal(rec.Status, st); err != nil {
+			return nil, status.Errorf(codes.Internal, "couldn't unmarshal stored status: %v", err)
+		}
+		return nil, status.ErrorProto(st)
+	}
+	packed := &anypb.Any{}
+	if err := proto.Unmarshal(rec.Response, packed); err != nil {
+		return nil, status.Errorf(codes.Internal, "couldn't unmarshal stored response: %v", err)
+	}
+	resp, err := packed.UnmarshalNew()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "couldn't unmarshal stored response: %v", err)
+	}
+	return resp, nil
+}
+
+// recordingStream records the metadata set by the handler
+// and passes it to the call's stream.
+type recordingStream struct {
+	grpc.ServerTransportStream
+
+	mu      sync.Mutex
+	header  metadata.MD
+	trailer metadata.MD
+}
+
+// SetHeader implements grpc.ServerTransportStream.
+func (s *recordingStream) SetHeader(md metadata.MD) error {
+	if s.ServerTransportStream != nil {
+		if err := s.ServerTransportStream.SetHeader(md); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	s.header = metadata.Join(s.header, md)
+	s.mu.Unlock()
+	return nil
+}
+
+// SendHeader implements grpc.ServerTransportStream.
+func (s *recordingStream) SendHeader(md metadata.MD) error {
+	if s.ServerTransportStream != nil {
+		if err := s.ServerTransportStream.SendHeader(md); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	s.header = metadata.Join(s.header, md)
+	s.mu.Unlock()
+	return nil
+}
+
+// SetTrailer implements grpc.ServerTransportStream.
+func (s *recordingStream) SetTrailer(md metadata.MD) error {
+	if s.ServerTransportStream != nil {
+		if err := s.ServerTransportStream.SetTrailer(md); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	s.trailer = metadata.Join(s.trailer, md)
+	s.mu.Unlock()
+	return nil
+}
+
+// Method implements grpc.ServerTransportStream.
+func (s *recordingStream) Method() string {
+	if s.ServerTransportStream == nil {
+		return ""
+	}
+	return s.ServerTransportStream.Method()
+}
+
+func (s *recordingStream) record(fp []byte, resp interface{}, err error) (*Record, error) {
+	s.mu.Lock()
+	rec := &Record{
+		Fingerprint: fp,
+		Header:      s.header.Copy(),
+		Trailer:     s.trailer.Copy(),
+	}
+	s.mu.Unlock()
+
+	if err != nil {
+		buf, merr := proto.Marshal(status.Convert(err).Proto())
+		if merr != nil {
+			return nil, merr
+		}
+		rec.Status = buf
+		return rec, nil
+	}
+	msg, ok := resp.(proto.Message)
+	if !ok {
+		return nil, status.Errorf(codes.Internal, "response %T is not a proto message", resp)
+	}
+	packed, merr := anypb.New(msg)
+	if merr != nil {
+		return nil, merr
+	}
+	buf, merr := proto.Marshal(packed)
+	if merr != nil {
+		return nil, merr
+	}
+	rec.Response = buf
+	return rec, nil
+}
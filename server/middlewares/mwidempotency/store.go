@@ -0,0 +1,113 @@
+package mwidempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/metadata"
+)
+
+// ErrInProgress is returned by Store.Begin if the call
+// with the same key is not completed yet.
+var ErrInProgress = errors.New("call with the same idempotency key is in progress")
+
+// Record is the stored outcome of the call.
+type Record struct {
+	// Fingerprint is the hash of the request.
+	Fingerprint []byte
+	// Response is the marshaled google.protobuf.Any of the response,
+	// empty if the call failed.
+	Response []byte
+	// Status is the marshaled google.rpc.Status of the call's error,
+	// empty if the call succeeded.
+	Status []byte
+	// Header and Trailer are the metadata set by the handler.
+	Header  metadata.MD
+	Trailer metadata.MD
+}
+
+// Store keeps the calls' records.
+type Store interface {
+	// Begin reserves the key for the call in flight for the lease.
+	// It returns the record if the call with the key is completed
+	// already, ErrInProgress if it's in progress or nil record
+	// if the key is reserved for the caller.
+	Begin(ctx context.Context, key string, lease time.Duration) (*Record, error)
+	// Complete stores the call's record for ttl.
+	Complete(ctx context.Context, key string, rec *Record, ttl time.Duration) error
+	// Release drops the key's reservation so the call can be retried.
+	Release(ctx context.Context, key string) error
+}
+
+const memoryStoreSweepInterval = time.Minute
+
+// MemoryStore is the in-memory Store.
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]*entry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type entry struct {
+	rec     *Record
+	expires time.Time
+}
+
+// NewMemoryStore creates new in-memory Store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: map[string]*entry{},
+		now:     time.Now,
+	}
+}
+
+// Begin implements Store.
+func (s *MemoryStore) Begin(_ context.Context, key string, lease time.Duration) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	if e, ok := s.entries[key]; ok && now.Before(e.expires) {
+		if e.rec == nil {
+			return nil, ErrInProgress
+		}
+		return e.rec, nil
+	}
+	s.entries[key] = &entry{expires: now.Add(lease)}
+	return nil, nil
+}
+
+// Complete implements Store.
+func (s *MemoryStore) Complete(_ context.Context, key string, rec *Record, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = &entry{rec: rec, expires: s.now().Add(ttl)}
+	return nil
+}
+
+// Release implements Store.
+func (s *MemoryStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok && e.rec == nil {
+		delete(s.entries, key)
+	}
+	return nil
+}
+
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < memoryStoreSweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, e := range s.entries {
+		if !now.Before(e.expires) {
+			delete(s.entries, key)
+		}
+	}
+}
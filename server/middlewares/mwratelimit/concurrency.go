@@ -0,0 +1,129 @@
+package mwratelimit
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/not-for-prod/clay/server/middlewares/mwhttp"
+	"github.com/not-for-prod/clay/transport"
+	"github.com/not-for-prod/clay/transport/httpruntime"
+	"github.com/not-for-prod/clay/transport/httptransport"
+	"google.golang.org/grpc"
+)
+
+// concurrencyRetryDelay is the RetryInfo's delay for calls
+// rejected by the ConcurrencyLimiter.
+const concurrencyRetryDelay = time.Second
+
+// ConcurrencyLimiter limits the number of in-flight calls per method.
+// Calls over the limit are rejected immediately.
+type ConcurrencyLimiter struct {
+	max   int
+	rules []methodMaxInFlight
+
+	mu       sync.Mutex
+	inFlight map[string]int
+}
+
+type methodMaxInFlight struct {
+	match httptransport.MethodMatcher
+	max   int
+}
+
+// NewConcurrencyLimiter creates the ConcurrencyLimiter allowing max
+// in-flight calls of every method. Zero max means no limit.
+func NewConcurrencyLimiter(max int) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{
+		max:      max,
+		inFlight: map[string]int{},
+	}
+}
+
+// WithMethodMaxInFlight overrides the limit for the methods matched by m.
+// The first matching rule wins.
+func (l *ConcurrencyLimiter) WithMethodMaxInFlight(m httptransport.MethodMatcher, max int) *ConcurrencyLimiter {
+	l.rules = append(l.rules, methodMaxInFlight{match: m, max: max})
+	return l
+}
+
+// Acquire reserves the in-flight slot for the call of the method.
+// Returned function releases the slot; it is nil if the error is returned.
+func (l *ConcurrencyLimiter) Acquire(method string) (func(), error) {
+	max := l.max
+	for _, r := range l.rules {
+		if r.match(method) {
+			max = r.max
+			break
+		}
+	}
+	if max <= 0 {
+		return func() {}, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight[method] >= max {
+		return nil, exhausted("too many concurrent calls", concurrencyRetryDelay)
+	}
+	l.inFlight[method]++
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.inFlight[method]--
+		if l.inFlight[method] == 0 {
+			delete(l.inFlight, method)
+		}
+	}, nil
+}
+
+// UnaryServerInterceptor returns the unary interceptor limiting calls.
+func (l *ConcurrencyLimiter) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		release, err := l.Acquire(info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns the stream interceptor limiting calls.
+func (l *ConcurrencyLimiter) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		release, err := l.Acquire(info.FullMethod)
+		if err != nil {
+			return err
+		}
+		defer release()
+		return handler(srv, stream)
+	}
+}
+
+// Middleware returns the HTTP middleware limiting requests by the routes
+// they match, see RequestMethod.
+func (l *ConcurrencyLimiter) Middleware(routes *transport.RouteTable) mwhttp.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			release, err := l.Acquire(RequestMethod(routes, r))
+			if err != nil {
+				httpruntime.SetError(r.Context(), r, w, err)
+				return
+			}
+			defer release()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,21 @@
+/*
+Package mwratelimit provides rate limiting and concurrency limiting
+middlewares for gRPC and HTTP servers.
+
+Rejected calls fail with codes.ResourceExhausted carrying RetryInfo details;
+HTTP clients get 429 Too Many Requests with the Retry-After header.
+
+The interceptors limit both gRPC calls and ServiceDescs' HTTP requests when
+passed to server.WithGRPCUnaryMiddlewares; don't limit the same requests with
+the HTTP middlewares as well. The HTTP middlewares match the requests against
+the RouteTable, so the rules written as /package.Service/Method apply to
+the routes of transport.DescRoutes, and the paths' parameters don't make
+buckets of their own. Add the routes of the other handlers to limit them
+separately:
+
+	routes, _ := transport.DescRoutes(desc)
+	mw := limiter.Middleware(transport.NewRouteTable(append(routes,
+		transport.Route{Method: http.MethodGet, Path: "/files/{name}"},
+	)))
+*/
+package mwratelimit
@@ -0,0 +1,63 @@
+package mwratelimit
+
+import (
+	"context"
+	"net"
+
+	"github.com/not-for-prod/clay/server/middlewares/mwauth"
+	"google.golang.org/grpc/peer"
+)
+
+// KeyFunc returns the key of the bucket the call is limited by.
+// method is the full gRPC method name for gRPC calls and
+// the one returned by RequestMethod for HTTP requests.
+type KeyFunc func(ctx context.Context, method string) string
+
+// ByMethod limits every method separately.
+func ByMethod() KeyFunc {
+	return func(_ context.Context, method string) string {
+		return method
+	}
+}
+
+// ByPrincipal limits every principal authenticated by mwauth separately.
+// Unauthenticated calls share the same bucket.
+func ByPrincipal() KeyFunc {
+	return func(ctx context.Context, _ string) string {
+		if p, ok := mwauth.FromContext(ctx); ok {
+			return p.Authenticator + ":" + p.Subject
+		}
+		return ""
+	}
+}
+
+// ByClientIP limits every client IP separately.
+// Use mwhttp.Peer middleware to make the client's address
+// available to the HTTP handlers.
+func ByClientIP() KeyFunc {
+	return func(ctx context.Context, _ string) string {
+		p, ok := peer.FromContext(ctx)
+		if !ok || p.Addr == nil {
+			return ""
+		}
+		host, _, err := net.SplitHostPort(p.Addr.String())
+		if err != nil {
+			return p.Addr.String()
+		}
+		return host
+	}
+}
+
+// Join limits calls by the combination of the keys.
+func Join(keys ...KeyFunc) KeyFunc {
+	return func(ctx context.Context, method string) string {
+		ret := ""
+		for i, k := range keys {
+			if i > 0 {
+				ret += "|"
+			}
+			ret += k(ctx, method)
+		}
+		return ret
+	}
+}
@@ -0,0 +1,176 @@
+package mwratelimit
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/not-for-prod/clay/server/middlewares/mwhttp"
+	"github.com/not-for-prod/clay/transport"
+	"github.com/not-for-prod/clay/transport/httpruntime"
+	"github.com/not-for-prod/clay/transport/httptransport"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Option is an optional setting of the Limiter.
+type Option func(*Limiter)
+
+// WithStore sets the Store keeping token buckets.
+// MemoryStore is used by default.
+func WithStore(s Store) Option {
+	return func(l *Limiter) {
+		l.store = s
+	}
+}
+
+// WithKey sets the way calls are grouped to be limited.
+// Calls are limited by method by default.
+func WithKey(k KeyFunc) Option {
+	return func(l *Limiter) {
+		l.key = k
+	}
+}
+
+// WithMethodLimit overrides the Limit for the methods matched by m.
+// The first matching rule wins.
+func WithMethodLimit(m httptransport.MethodMatcher, limit Limit) Option {
+	return func(l *Limiter) {
+		l.rules = append(l.rules, methodLimit{match: m, limit: limit})
+	}
+}
+
+type methodLimit struct {
+	match httptransport.MethodMatcher
+	limit Limit
+}
+
+// Limiter is the token bucket rate limiter.
+type Limiter struct {
+	store Store
+	key   KeyFunc
+	limit Limit
+	rules []methodLimit
+}
+
+// New creates the Limiter applying the limit to every group of calls.
+func New(limit Limit, opts ...Option) *Limiter {
+	l := &Limiter{
+		store: NewMemoryStore(),
+		key:   ByMethod(),
+		limit: limit,
+	}
+	for _, o := range opts {
+		o(l)
+	}
+	return l
+}
+
+// Allow takes a token for the call of the method.
+// It returns the ResourceExhausted status error if the call is limited.
+func (l *Limiter) Allow(ctx context.Context, method string) error {
+	rule, limit := "*", l.limit
+	for i, r := range l.rules {
+		if r.match(method) {
+			rule, limit = strconv.Itoa(i), r.limit
+			break
+		}
+	}
+
+	wait, err := l.store.Take(ctx, rule+"|"+l.key(ctx, method), limit)
+	if err != nil {
+		return status.Errorf(codes.Internal, "rate limiter failure: %v", err)
+	}
+	if wait > 0 {
+		return exhausted("rate limit exceeded", wait)
+	}
+	return nil
+}
+
+// UnaryServerInterceptor returns the unary interceptor limiting calls.
+func (l *Limiter) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		if err := l.Allow(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns the stream interceptor limiting calls.
+func (l *Limiter) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		if err := l.Allow(stream.Context(), info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, stream)
+	}
+}
+
+// Middleware returns the HTTP middleware limiting requests by the routes
+// they match, see RequestMethod.
+func (l *Limiter) Middleware(routes *transport.RouteTable) mwhttp.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := l.Allow(requestContext(r), RequestMethod(routes, r)); err != nil {
+				httpruntime.SetError(r.Context(), r, w, err)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// UnmatchedMethod is the method of the HTTP requests
+// matching none of the routes.
+const UnmatchedMethod = "*"
+
+// RequestMethod returns the method the HTTP request is limited as:
+// the full gRPC method name of the route it matches, or the route's
+// HTTP method and path template if the route has no gRPC method.
+// Requests matching none of the routes share UnmatchedMethod,
+// so the paths' parameters don't create buckets of their own.
+func RequestMethod(routes *transport.RouteTable, r *http.Request) string {
+	if routes == nil {
+		return UnmatchedMethod
+	}
+	if route, ok := routes.Match(r.Method, r.URL.Path); ok {
+		return route.Name()
+	}
+	return UnmatchedMethod
+}
+
+// requestContext returns the request's context with the peer info,
+// unless it's set already.
+func requestContext(r *http.Request) context.Context {
+	ctx := r.Context()
+	if _, ok := peer.FromContext(ctx); ok {
+		return ctx
+	}
+	return peer.NewContext(ctx, mwhttp.RequestPeer(r))
+}
+
+func exhausted(msg string, wait time.Duration) error {
+	st, err := status.New(codes.ResourceExhausted, msg).WithDetails(
+		&errdetails.RetryInfo{RetryDelay: durationpb.New(wait)},
+	)
+	if err != nil {
+		return status.Error(codes.ResourceExhausted, msg)
+	}
+	return st.Err()
+}
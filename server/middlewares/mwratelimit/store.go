@@ -0,0 +1,117 @@
+package mwratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit is the token bucket's setting.
+// Zero Rate means no limit.
+type Limit struct {
+	// Rate is the number of tokens added to the bucket per second.
+	Rate float64
+	// Burst is the bucket's size, at least 1.
+	Burst int
+}
+
+func (l Limit) size() float64 {
+	if l.Burst < 1 {
+		return 1
+	}
+	return float64(l.Burst)
+}
+
+// PerSecond returns the Limit allowing n calls per second with bursts of n calls.
+func PerSecond(n int) Limit {
+	return Limit{Rate: float64(n), Burst: n}
+}
+
+// PerMinute returns the Limit allowing n calls per minute with bursts of n calls.
+func PerMinute(n int) Limit {
+	return Limit{Rate: float64(n) / 60, Burst: n}
+}
+
+// Store keeps the token buckets.
+type Store interface {
+	// Take takes a token from the bucket identified by key.
+	// It returns zero if the token is taken or the time
+	// until the next token is available otherwise.
+	Take(ctx context.Context, key string, l Limit) (time.Duration, error)
+}
+
+const memoryStoreSweepInterval = time.Minute
+
+// MemoryStore is the in-memory Store.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	limit  Limit
+}
+
+// NewMemoryStore creates new in-memory Store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: map[string]*bucket{},
+		now:     time.Now,
+	}
+}
+
+// Take implements Store.
+func (s *MemoryStore) Take(_ context.Context, key string, l Limit) (time.Duration, error) {
+	if l.Rate <= 0 {
+		return 0, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.size(), last: now, limit: l}
+		s.buckets[key] = b
+	}
+	b.limit = l
+	b.refill(now)
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, nil
+	}
+	wait := (1 - b.tokens) / l.Rate
+	return time.Duration(math.Ceil(wait * float64(time.Second))), nil
+}
+
+func (b *bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(b.limit.size(), b.tokens+elapsed*b.limit.Rate)
+		b.last = now
+	}
+}
+
+// sweep drops the buckets that are full again, they're
+// indistinguishable from the new ones.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < memoryStoreSweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, b := range s.buckets {
+		b.refill(now)
+		if b.tokens >= b.limit.size() {
+			delete(s.buckets, key)
+		}
+	}
+}
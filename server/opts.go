@@ -1,13 +1,23 @@
 package server
 
 import (
+	"net"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/not-for-prod/clay/server/log"
+	"github.com/not-for-prod/clay/server/middlewares/mwgrpc"
 	"github.com/not-for-prod/clay/server/middlewares/mwhttp"
+	"github.com/not-for-prod/clay/transport"
+	"github.com/not-for-prod/clay/transport/compression"
+	"github.com/not-for-prod/clay/transport/httpruntime"
+	"github.com/not-for-prod/clay/transport/httptransport"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/protobuf/encoding/protojson"
 )
 
 // Option is an optional setting applied to the Server.
@@ -18,14 +28,45 @@ type serverOpts struct {
 	// If HTTPPort is the same then muxing listener is created.
 	HTTPPort int
 	HTTPMux  *chi.Mux
+	// PathPrefix is the prefix every HTTP route is served under.
+	PathPrefix string
+	// Listener is used instead of listening on the ports if set.
+	Listener net.Listener
 
 	HTTPMiddlewares []func(http.Handler) http.Handler
+	CORS            *mwhttp.CORSOptions
+	Compression     *mwhttp.CompressOptions
 
-	GRPCOpts             []grpc.ServerOption
-	GRPCUnaryInterceptor grpc.UnaryServerInterceptor
+	GRPCOpts []grpc.ServerOption
+	// GRPCCreds secure the gRPC connections accepted over the network.
+	GRPCCreds credentials.TransportCredentials
+	// GRPCUnaryInterceptors are chained and applied to both gRPC server
+	// and ServiceDescs' HTTP handlers.
+	GRPCUnaryInterceptors  []grpc.UnaryServerInterceptor
+	GRPCStreamInterceptors []grpc.StreamServerInterceptor
+
+	Deadlines mwgrpc.Deadlines
 
 	EnableReflection    bool
 	RuntimeServeMuxOpts []runtime.ServeMuxOption
+	// InProcessGateway makes the gateway call the gRPC server
+	// through the in-memory connection.
+	InProcessGateway bool
+	// DynamicServices allows to add and remove ServiceDescs at runtime.
+	DynamicServices bool
+	// Docs sets up the Swagger spec and docs UI endpoints.
+	Docs DocsOptions
+	// Admin sets up the admin endpoints.
+	Admin AdminOptions
+	// Logger logs the server's events, log.Default is used if nil.
+	Logger log.Writer
+	// Marshalers are the HTTP marshalers negotiated by MIME type.
+	Marshalers []mimeMarshaler
+}
+
+type mimeMarshaler struct {
+	MIME      string
+	Marshaler runtime.Marshaler
 }
 
 func defaultServerOpts(mainPort int) *serverOpts {
@@ -43,6 +84,16 @@ func WithGRPCOpts(opts ...grpc.ServerOption) Option {
 	}
 }
 
+// WithGRPCCreds sets the transport credentials of the gRPC server.
+// Use it instead of grpc.Creds in WithGRPCOpts: the credentials
+// are applied to the network connections only, so the in-process
+// gateway and the dynamic services keep working.
+func WithGRPCCreds(creds credentials.TransportCredentials) Option {
+	return func(o *serverOpts) {
+		o.GRPCCreds = creds
+	}
+}
+
 // WithHTTPPort sets HTTP RPC port to listen on.
 // Set same port as main to use single port.
 func WithHTTPPort(port int) Option {
@@ -51,6 +102,25 @@ func WithHTTPPort(port int) Option {
 	}
 }
 
+// WithPathPrefix serves every HTTP route under the prefix, including
+// the gateway's routes, docs, swagger and the HTTPMux's own routes;
+// i.e. /swagger.json is served at /api/items/swagger.json with /api/items
+// prefix. Swagger's basePath is set to match.
+// Use transport.WithPathPrefix to mount ServiceDescs under different prefixes.
+func WithPathPrefix(prefix string) Option {
+	return func(o *serverOpts) {
+		o.PathPrefix = transport.CleanPathPrefix(prefix)
+	}
+}
+
+// WithListener makes the server serve both gRPC and HTTP
+// on the listener instead of listening on the ports.
+func WithListener(l net.Listener) Option {
+	return func(o *serverOpts) {
+		o.Listener = l
+	}
+}
+
 // WithHTTPMiddlewares sets up HTTP middlewares to work with.
 func WithHTTPMiddlewares(mws ...mwhttp.Middleware) Option {
 	mwGeneric := make([]func(http.Handler) http.Handler, 0, len(mws))
@@ -62,22 +132,180 @@ func WithHTTPMiddlewares(mws ...mwhttp.Middleware) Option {
 	}
 }
 
+// WithCORS sets up CORS handling for HTTP requests.
+// Unless set, allowed methods are taken from the ServiceDescs' routes.
+// Server fails to start with invalid options, see mwhttp.CORSOptions.Validate.
+func WithCORS(opts mwhttp.CORSOptions) Option {
+	return func(o *serverOpts) {
+		o.CORS = &opts
+	}
+}
+
+// WithCompression sets up HTTP responses compression negotiated
+// via Accept-Encoding and decompression of the requests' bodies.
+// The same codecs are registered as gRPC compressors, so they're available
+// to gRPC clients via grpc.UseCompressor; the registration is process-wide
+// and must happen before gRPC is used, see compression.RegisterGRPC.
+func WithCompression(opts mwhttp.CompressOptions) Option {
+	return func(o *serverOpts) {
+		codecs := opts.Codecs
+		if len(codecs) == 0 {
+			codecs = compression.DefaultCodecs
+		}
+		for _, c := range codecs {
+			compression.RegisterGRPC(c)
+		}
+		o.Compression = &opts
+	}
+}
+
 // WithGRPCUnaryMiddlewares sets up unary middlewares for gRPC server.
 func WithGRPCUnaryMiddlewares(mws ...grpc.UnaryServerInterceptor) Option {
-	mw := grpc_middleware.ChainUnaryServer(mws...)
 	return func(o *serverOpts) {
-		o.GRPCOpts = append(o.GRPCOpts, grpc.UnaryInterceptor(mw))
-		o.GRPCUnaryInterceptor = mw
+		o.GRPCUnaryInterceptors = append(o.GRPCUnaryInterceptors, mws...)
+	}
+}
+
+// WithGRPCMethodUnaryMiddlewares sets up unary middlewares for the methods
+// matched by m, see httptransport.MatchMethods.
+func WithGRPCMethodUnaryMiddlewares(m httptransport.MethodMatcher, mws ...grpc.UnaryServerInterceptor) Option {
+	mw := httptransport.SelectUnaryInterceptor(m, grpc_middleware.ChainUnaryServer(mws...))
+	return func(o *serverOpts) {
+		o.GRPCUnaryInterceptors = append(o.GRPCUnaryInterceptors, mw)
 	}
 }
 
 // WithGRPCStreamMiddlewares sets up stream middlewares for gRPC server.
 func WithGRPCStreamMiddlewares(mws ...grpc.StreamServerInterceptor) Option {
 	return func(o *serverOpts) {
-		o.GRPCOpts = append(o.GRPCOpts, grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(mws...)))
+		o.GRPCStreamInterceptors = append(o.GRPCStreamInterceptors, mws...)
+	}
+}
+
+// WithRequestValidation validates the requests having generated
+// Validate methods on both gRPC and HTTP paths, see mwgrpc.UnaryValidator.
+func WithRequestValidation() Option {
+	return func(o *serverOpts) {
+		o.GRPCUnaryInterceptors = append(o.GRPCUnaryInterceptors, mwgrpc.UnaryValidator())
+		o.GRPCStreamInterceptors = append(o.GRPCStreamInterceptors, mwgrpc.StreamValidator())
+	}
+}
+
+// WithDefaultTimeout sets the timeout for both gRPC and HTTP calls
+// that come without a deadline.
+func WithDefaultTimeout(d time.Duration) Option {
+	return func(o *serverOpts) {
+		o.Deadlines.Default = d
 	}
 }
 
+// WithMethodTimeout sets the timeout for calls of the methods matched by m
+// that come without a deadline, overriding the default one.
+func WithMethodTimeout(m httptransport.MethodMatcher, d time.Duration) Option {
+	return func(o *serverOpts) {
+		o.Deadlines.Methods = append(o.Deadlines.Methods, mwgrpc.MethodTimeout{Match: m, Timeout: d})
+	}
+}
+
+// WithMaxTimeout caps the deadlines requested by clients.
+// HTTP clients can request deadlines via Grpc-Timeout
+// and Request-Timeout headers; the latter is honored only
+// if any of the timeout options is set.
+func WithMaxTimeout(d time.Duration) Option {
+	return func(o *serverOpts) {
+		o.Deadlines.Max = d
+	}
+}
+
+// WithInProcessGateway makes HTTP handlers dispatch calls through
+// the in-memory connection to the server's gRPC server instead of
+// calling the implementation directly. Every gRPC server option,
+// interceptor, stats handler and streaming method applies to HTTP
+// requests then; ServiceDescs not implementing transport.ClientServiceDesc
+// are registered as usual.
+//
+// gRPC peer of such calls is the in-memory connection; the client's
+// address is passed in the x-forwarded-for metadata.
+// The in-memory connection is insecure: set the transport credentials
+// with WithGRPCCreds, Run fails if grpc.Creds is passed to WithGRPCOpts.
+func WithInProcessGateway() Option {
+	return func(o *serverOpts) {
+		o.InProcessGateway = true
+	}
+}
+
+// WithDynamicServices allows to add and remove ServiceDescs of the running
+// server via Server.AddService and Server.RemoveService.
+// gRPC health service reporting the served services' status is registered too.
+//
+// Calls of the services added at runtime are proxied as raw frames, so the gRPC
+// server's codec is forced to the registered "proto" one; Run fails if
+// a codec is forced by grpc.ForceServerCodec in WithGRPCOpts.
+// gRPC reflection lists the services served at the moment.
+func WithDynamicServices() Option {
+	return func(o *serverOpts) {
+		o.DynamicServices = true
+	}
+}
+
+// WithAdmin serves the admin endpoints by the listener,
+// see AdminOptions.
+func WithAdmin(opts AdminOptions) Option {
+	return func(o *serverOpts) {
+		o.Admin = opts
+	}
+}
+
+// WithDocs sets up the Swagger spec and docs UI endpoints,
+// see DocsOptions.
+func WithDocs(opts DocsOptions) Option {
+	return func(o *serverOpts) {
+		o.Docs = opts
+	}
+}
+
+// WithoutDocs disables the Swagger spec and docs UI endpoints.
+func WithoutDocs() Option {
+	return func(o *serverOpts) {
+		o.Docs.Disabled = true
+	}
+}
+
+// WithLogger sets the logger of the server's events,
+// i.e. the route table logged at start. log.Default is used by default.
+func WithLogger(l log.Writer) Option {
+	return func(o *serverOpts) {
+		o.Logger = l
+	}
+}
+
+// WithMarshaler registers the HTTP marshaler for the MIME type.
+// Marshalers are picked by requests' Content-Type and Accept headers;
+// requests accepting none of the registered types (or JSON) are rejected
+// with 406 Not Acceptable, and bodies of unknown types with 415.
+// Marshaler registered for runtime.MIMEWildcard replaces the default JSON one.
+func WithMarshaler(mime string, m runtime.Marshaler) Option {
+	return func(o *serverOpts) {
+		o.Marshalers = append(o.Marshalers, mimeMarshaler{MIME: mime, Marshaler: m})
+	}
+}
+
+// WithProtobufMarshaler registers the protobuf binary marshaler
+// for httpruntime.MIMEProtobuf.
+func WithProtobufMarshaler() Option {
+	return WithMarshaler(httpruntime.MIMEProtobuf, httpruntime.ProtobufMarshaler(httpruntime.MIMEProtobuf))
+}
+
+// WithJSONMarshaler sets the protojson options of the JSON marshaler.
+func WithJSONMarshaler(mo protojson.MarshalOptions, uo protojson.UnmarshalOptions) Option {
+	return WithMarshaler(runtime.MIMEWildcard, httpruntime.JSONMarshaler(mo, uo))
+}
+
+// WithYAMLMarshaler registers the YAML marshaler for httpruntime.MIMEYAML.
+func WithYAMLMarshaler(mo protojson.MarshalOptions, uo protojson.UnmarshalOptions) Option {
+	return WithMarshaler(httpruntime.MIMEYAML, httpruntime.YAMLMarshaler(mo, uo))
+}
+
 // WithHTTPMux sets existing HTTP muxer to use instead of creating new one.
 func WithHTTPMux(mux *chi.Mux) Option {
 	return func(o *serverOpts) {
@@ -85,6 +313,12 @@ func WithHTTPMux(mux *chi.Mux) Option {
 	}
 }
 
+// WithMetadataRules sets up forwarding of HTTP headers and cookies
+// to gRPC metadata and back.
+func WithMetadataRules(r httpruntime.MetadataRules) Option {
+	return WithRuntimeServeMuxOpts(r.ServeMuxOptions()...)
+}
+
 func WithRuntimeServeMuxOpts(opts ...runtime.ServeMuxOption) Option {
 	return func(o *serverOpts) {
 		o.RuntimeServeMuxOpts = append(o.RuntimeServeMuxOpts, opts...)
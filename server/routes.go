@@ -0,0 +1,138 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/not-for-prod/clay/server/log"
+	"github.com/not-for-prod/clay/transport"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+)
+
+// RoutesPath is the path the route table is served at, see AdminOptions.
+const RoutesPath = "/debug/routes"
+
+// routeTable is the HTTP routes of the served ServiceDescs.
+type routeTable struct {
+	Routes    []transport.Route         `json:"routes"`
+	Conflicts []transport.RouteConflict `json:"conflicts,omitempty"`
+}
+
+// newRouteTable creates the route table of the ServiceDescs' routes
+// in the order of registration, see descRoutes.
+func newRouteTable(routes [][]transport.Route) *routeTable {
+	t := &routeTable{Routes: []transport.Route{}}
+	for _, rr := range routes {
+		t.Routes = append(t.Routes, rr...)
+	}
+	sort.SliceStable(t.Routes, func(i, j int) bool {
+		if t.Routes[i].Path != t.Routes[j].Path {
+			return t.Routes[i].Path < t.Routes[j].Path
+		}
+		return t.Routes[i].Method < t.Routes[j].Method
+	})
+	t.Conflicts = transport.RouteConflicts(routes...)
+	return t
+}
+
+// registeredDesc is the ServiceDesc registered by the gRPC server.
+type registeredDesc struct {
+	desc transport.ServiceDesc
+	// services are the gRPC services registered by desc.
+	services map[string]grpc.ServiceInfo
+}
+
+// registerDescs registers the ServiceDesc by the gRPC server,
+// ServiceDescs joined by it are registered one by one.
+func registerDescs(g *grpc.Server, desc transport.ServiceDesc) []registeredDesc {
+	var ret []registeredDesc
+	for _, d := range flattenDescs([]transport.ServiceDesc{desc}) {
+		ret = append(ret, registeredDesc{desc: d, services: transport.RegisterGRPC(g, d)})
+	}
+	return ret
+}
+
+// serviceNames returns the gRPC services registered by the ServiceDescs.
+func serviceNames(descs []registeredDesc) []string {
+	var ret []string
+	for _, d := range descs {
+		for name := range d.services {
+			ret = append(ret, name)
+		}
+	}
+	return ret
+}
+
+// descRoutes returns the HTTP routes of the registered ServiceDescs
+// served under the prefix.
+func descRoutes(prefix string, descs []registeredDesc) ([][]transport.Route, error) {
+	ret := make([][]transport.Route, len(descs))
+	for i, d := range descs {
+		var err error
+		if ret[i], err = transport.DescRoutes(d.desc, d.services); err != nil {
+			return nil, errors.Wrap(err, "couldn't get HTTP routes")
+		}
+		for j := range ret[i] {
+			ret[i][j].Path = prefix + ret[i][j].Path
+		}
+	}
+	return ret, nil
+}
+
+// flattenDescs replaces CompoundServiceDescs with the joined ServiceDescs.
+func flattenDescs(descs []transport.ServiceDesc) []transport.ServiceDesc {
+	var ret []transport.ServiceDesc
+	for _, desc := range descs {
+		if c, ok := desc.(*transport.CompoundServiceDesc); ok {
+			ret = append(ret, flattenDescs(c.ServiceDescs())...)
+			continue
+		}
+		ret = append(ret, desc)
+	}
+	return ret
+}
+
+// updateRoutes rebuilds the route table of the ServiceDescs' routes
+// and warns about the conflicting routes.
+func (s *Server) updateRoutes(routes [][]transport.Route) {
+	t := newRouteTable(routes)
+	s.routes.Store(t)
+	for _, c := range t.Conflicts {
+		s.logger().Logf(log.LevelWarning, "HTTP route %v", c)
+	}
+}
+
+// Routes returns the HTTP routes of the served ServiceDescs,
+// their paths include the desc and the server's path prefixes.
+// It returns nil unless the server is running.
+func (s *Server) Routes() []transport.Route {
+	t := s.routes.Load()
+	if t == nil {
+		return nil
+	}
+	return append([]transport.Route(nil), t.Routes...)
+}
+
+func (s *Server) logRoutes() {
+	for _, r := range s.routes.Load().Routes {
+		body := r.Body
+		if body == "" {
+			body = "-"
+		}
+		s.logger().Logf(log.LevelInfo, "HTTP route %v %v -> %v, body: %v", r.Method, r.Path, r.FullMethod, body)
+	}
+}
+
+func (s *Server) serveRoutes(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.routes.Load())
+}
+
+func (s *Server) logger() log.Writer {
+	if s.opts.Logger != nil {
+		return s.opts.Logger
+	}
+	return log.Default
+}
@@ -3,8 +3,10 @@ package server
 import (
 	"context"
 	"net/http"
+	"sync/atomic"
 
 	"github.com/not-for-prod/clay/transport"
+	"github.com/pkg/errors"
 	"google.golang.org/grpc"
 )
 
@@ -13,8 +15,19 @@ type Server struct {
 	opts        *serverOpts
 	listeners   *listenerSet
 	serviceDesc transport.ServiceDesc
+	descs       []transport.ServiceDesc
 	httpServer  *http.Server
+	docsServer  *http.Server
+	adminServer *http.Server
 	grpcServer  *grpc.Server
+	// inProcessConn is the gateway's connection to grpcServer, if enabled.
+	inProcessConn *grpc.ClientConn
+	// registered are the gRPC services of descs registered by grpcServer.
+	registered [][]registeredDesc
+	// routes is the route table of the served ServiceDescs.
+	routes atomic.Pointer[routeTable]
+	// dynamic keeps the ServiceDescs added and removed at runtime, if enabled.
+	dynamic *dynamicServices
 }
 
 // NewServer creates a Server listening on the rpcPort.
@@ -26,7 +39,11 @@ func NewServer(rpcPort int, opts ...Option) *Server {
 	for _, opt := range opts {
 		opt(serverOpts)
 	}
-	return &Server{opts: serverOpts}
+	s := &Server{opts: serverOpts}
+	if serverOpts.DynamicServices {
+		s.dynamic = newDynamicServices()
+	}
+	return s
 }
 
 // Run starts processing requests to the service.
@@ -34,12 +51,13 @@ func NewServer(rpcPort int, opts ...Option) *Server {
 func (s *Server) Run(descs ...transport.ServiceDesc) error {
 	// Join several ServiceDescs in CompoundServiceDesc
 	s.serviceDesc = transport.NewCompoundServiceDesc(descs...)
+	s.descs = descs
 
 	// init Server
 	for _, fn := range []initFunc{
 		s.initListeners,
-		s.initHTTPServer,
 		s.initGRPCServer,
+		s.initHTTPServer,
 	} {
 		if err := fn(); err != nil {
 			return err
@@ -51,7 +69,7 @@ func (s *Server) Run(descs ...transport.ServiceDesc) error {
 }
 
 func (s *Server) run() error {
-	errChan := make(chan error, 5)
+	errChan := make(chan error, 7)
 
 	if s.listeners.mainListener != nil {
 		go func() {
@@ -67,6 +85,20 @@ func (s *Server) run() error {
 		}()
 	}
 
+	if s.docsServer != nil {
+		go func() {
+			err := s.docsServer.Serve(s.opts.Docs.Listener)
+			errChan <- err
+		}()
+	}
+
+	if s.adminServer != nil {
+		go func() {
+			err := s.adminServer.Serve(s.opts.Admin.Listener)
+			errChan <- err
+		}()
+	}
+
 	if s.grpcServer != nil {
 		go func() {
 			err := s.grpcServer.Serve(s.listeners.GRPC)
@@ -74,9 +106,53 @@ func (s *Server) run() error {
 		}()
 	}
 
+	if s.grpcServer != nil && s.listeners.InProcess != nil {
+		go func() {
+			err := s.grpcServer.Serve(s.listeners.InProcess)
+			errChan <- err
+		}()
+		go func() {
+			if err := checkBufconn(s.inProcessConn); err != nil {
+				errChan <- errors.Wrap(err, "in-process gateway can't reach the gRPC server")
+			}
+		}()
+	}
+
 	return <-errChan
 }
 
+// AddService starts serving the ServiceDesc by the running server.
+// It requires WithDynamicServices option.
+//
+// HTTP handlers and Swagger definition are swapped atomically.
+// The gRPC services of the ServiceDesc must not be served already;
+// their calls are proxied to the gRPC server created for the ServiceDesc
+// with the same options, so the gRPC peer of the calls is the in-memory
+// connection.
+func (s *Server) AddService(desc transport.ServiceDesc) error {
+	if s.dynamic == nil {
+		return errors.New("dynamic services are disabled, see WithDynamicServices")
+	}
+	if s.grpcServer == nil {
+		return errors.New("server is not running")
+	}
+	return s.dynamic.add(desc)
+}
+
+// RemoveService stops serving the ServiceDesc by the running server.
+// It requires WithDynamicServices option.
+// Calls of the removed gRPC services fail with codes.Unimplemented,
+// their health status is set to NOT_SERVING.
+func (s *Server) RemoveService(desc transport.ServiceDesc) error {
+	if s.dynamic == nil {
+		return errors.New("dynamic services are disabled, see WithDynamicServices")
+	}
+	if s.grpcServer == nil {
+		return errors.New("server is not running")
+	}
+	return s.dynamic.remove(desc)
+}
+
 // Stop stops the server gracefully.
 func (s *Server) Stop(ctx context.Context) error {
 	if s.httpServer != nil {
@@ -85,9 +161,29 @@ func (s *Server) Stop(ctx context.Context) error {
 		}
 	}
 
+	if s.docsServer != nil {
+		if err := s.docsServer.Shutdown(ctx); err != nil {
+			return err
+		}
+	}
+
+	if s.adminServer != nil {
+		if err := s.adminServer.Shutdown(ctx); err != nil {
+			return err
+		}
+	}
+
 	if s.grpcServer != nil {
 		s.grpcServer.GracefulStop()
 	}
 
+	if s.dynamic != nil {
+		s.dynamic.stop()
+	}
+
+	if s.inProcessConn != nil {
+		return s.inProcessConn.Close()
+	}
+
 	return nil
 }
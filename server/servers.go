@@ -1,17 +1,27 @@
 package server
 
 import (
-	"bytes"
 	"context"
-	"io"
+	"net"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/not-for-prod/clay/server/middlewares/mwgrpc"
+	"github.com/not-for-prod/clay/server/middlewares/mwhttp"
 	"github.com/not-for-prod/clay/transport"
-	httpSwagger "github.com/swaggo/http-swagger"
+	"github.com/not-for-prod/clay/transport/httpruntime"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/reflection"
+	reflectionv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	reflectionv1alpha "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/test/bufconn"
 
 	"github.com/pkg/errors"
 )
@@ -27,58 +37,316 @@ func (s *Server) initHTTPServer() error {
 	}
 
 	// Apply http middlewares
+	if s.opts.CORS != nil {
+		corsOpts := *s.opts.CORS
+		if err := corsOpts.Validate(); err != nil {
+			return err
+		}
+		if corsOpts.RouteMethods == nil && s.dynamic != nil {
+			corsOpts.RouteMethods = func(path string) []string {
+				return s.dynamic.routeTable().Methods(path)
+			}
+		} else if corsOpts.RouteMethods == nil {
+			routes, err := transport.SwaggerRoutes(s.serviceDesc.SwaggerDef())
+			if err != nil {
+				return errors.Wrap(err, "couldn't get HTTP routes")
+			}
+			corsOpts.RouteMethods = transport.NewRouteTable(routes).Methods
+		}
+		router.Use(mwhttp.CORS(corsOpts))
+	}
+	if s.opts.Compression != nil {
+		router.Use(
+			mwhttp.Decompress(*s.opts.Compression),
+			mwhttp.Compress(*s.opts.Compression),
+		)
+	}
+	if !s.opts.Deadlines.IsZero() {
+		router.Use(mwhttp.RequestTimeout())
+	}
 	if len(s.opts.HTTPMiddlewares) > 0 {
 		router.Use(s.opts.HTTPMiddlewares...)
 	}
 
-	// Inject static Swagger as root handler
-	router.HandleFunc(
-		"/swagger.json", func(w http.ResponseWriter, req *http.Request) {
-			io.Copy(w, bytes.NewReader(s.serviceDesc.SwaggerDef()))
-		},
-	)
-	router.HandleFunc(
-		"/docs/*", func(w http.ResponseWriter, r *http.Request) {
-			httpSwagger.Handler(httpSwagger.URL("swagger.json")).ServeHTTP(w, r)
-		},
-	)
-	router.Get(
-		"/docs", func(w http.ResponseWriter, r *http.Request) {
-			http.Redirect(w, r, "/docs/", http.StatusMovedPermanently)
-		},
-	)
-	router.Get(
-		"/docs/swagger.json", func(w http.ResponseWriter, r *http.Request) {
-			http.Redirect(w, r, "/swagger.json", http.StatusMovedPermanently)
-		},
-	)
+	// Swagger spec and docs
+	if s.opts.Docs.Listener != nil {
+		s.initDocsServer()
+	} else {
+		s.registerDocs(router, s.opts.PathPrefix)
+	}
+	if s.opts.Admin.Listener != nil {
+		s.initAdminServer()
+	}
 
 	// Register everything
-	mux := runtime.NewServeMux(s.opts.RuntimeServeMuxOpts...)
-
-	if err := s.serviceDesc.RegisterHTTP(context.Background(), mux); err != nil {
+	if s.listeners.InProcess != nil {
+		if err := s.dialInProcess(); err != nil {
+			return err
+		}
+	}
+	gateway, err := s.newGateway([]gatewayDesc{{desc: s.serviceDesc, conn: s.inProcessConn}})
+	if err != nil {
 		return errors.Wrap(err, "couldn't register HTTP server")
 	}
 
-	router.Mount("/", mux)
+	if s.dynamic != nil {
+		if err := s.dynamic.init(s); err != nil {
+			return err
+		}
+		s.dynamic.setGateway(gateway)
+		gateway = s.dynamic
+	} else {
+		var routes [][]transport.Route
+		for _, descs := range s.registered {
+			rr, err := descRoutes(s.opts.PathPrefix, descs)
+			if err != nil {
+				return err
+			}
+			routes = append(routes, rr...)
+		}
+		s.updateRoutes(routes)
+	}
+	s.logRoutes()
+	router.Mount("/", gateway)
+	var handler http.Handler = router
+	if s.opts.PathPrefix != "" {
+		handler = http.StripPrefix(s.opts.PathPrefix, router)
+	}
 	s.httpServer = &http.Server{
-		Handler: router,
+		Handler: handler,
 	}
 
 	return nil
 }
 
+// gatewayDesc is the ServiceDesc registered by the gateway along with
+// the in-process gRPC connection its calls are dispatched through, if any.
+type gatewayDesc struct {
+	desc transport.ServiceDesc
+	conn *grpc.ClientConn
+}
+
+// newGateway creates the gateway's handler with the ServiceDescs' handlers
+// registered. PrefixedServiceDescs get their own muxes mounted under
+// their prefixes.
+func (s *Server) newGateway(descs []gatewayDesc) (http.Handler, error) {
+	muxOpts := append(
+		[]runtime.ServeMuxOption{runtime.WithErrorHandler(httpruntime.HTTPErrorHandler)},
+		s.opts.RuntimeServeMuxOpts...,
+	)
+	var mimes []string
+	for _, m := range s.opts.Marshalers {
+		muxOpts = append(muxOpts, runtime.WithMarshalerOption(m.MIME, m.Marshaler))
+		if m.MIME != runtime.MIMEWildcard {
+			mimes = append(mimes, m.MIME)
+		}
+	}
+
+	muxes := prefixMux{"": runtime.NewServeMux(muxOpts...)}
+	for _, d := range descs {
+		for _, desc := range flattenDescs([]transport.ServiceDesc{d.desc}) {
+			var prefix string
+			if p, ok := desc.(*transport.PrefixedServiceDesc); ok {
+				prefix = p.PathPrefix()
+			}
+			if muxes[prefix] == nil {
+				muxes[prefix] = runtime.NewServeMux(muxOpts...)
+			}
+			if err := registerHTTP(muxes[prefix], desc, d.conn); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var h http.Handler = muxes
+	if len(muxes) == 1 {
+		h = muxes[""]
+	}
+	if len(mimes) > 0 {
+		return mwhttp.ContentNegotiation(mimes...)(h), nil
+	}
+	return h, nil
+}
+
+// prefixMux passes the requests to the gateway muxes by the longest
+// matching path prefix, the prefix is stripped.
+type prefixMux map[string]*runtime.ServeMux
+
+func (m prefixMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var prefix string
+	for p := range m {
+		if len(p) > len(prefix) && (r.URL.Path == p || strings.HasPrefix(r.URL.Path, p+"/")) {
+			prefix = p
+		}
+	}
+	if prefix == "" {
+		m[""].ServeHTTP(w, r)
+		return
+	}
+	http.StripPrefix(prefix, m[prefix]).ServeHTTP(w, r)
+}
+
+// swaggerDef returns the Swagger definition of the served ServiceDescs.
+func (s *Server) swaggerDef() []byte {
+	def := s.serviceDesc.SwaggerDef
+	if s.dynamic != nil {
+		def = s.dynamic.swaggerDef
+	}
+	return rewriteSpec(def(), s.opts.PathPrefix, &s.opts.Docs)
+}
+
+// registerHTTP registers the ServiceDesc's HTTP handlers,
+// dispatching the calls through the in-process gRPC connection if set.
+func registerHTTP(mux *runtime.ServeMux, desc transport.ServiceDesc, cc *grpc.ClientConn) error {
+	ctx := context.Background()
+	if d, ok := desc.(transport.ClientServiceDesc); ok && cc != nil {
+		return d.RegisterHTTPClient(ctx, mux, cc)
+	}
+	return desc.RegisterHTTP(ctx, mux)
+}
+
+// dialInProcess creates the gateway's in-process gRPC connection.
+func (s *Server) dialInProcess() error {
+	cc, err := dialBufconn(s.listeners.InProcess)
+	if err != nil {
+		return errors.Wrap(err, "couldn't create in-process gRPC connection")
+	}
+	s.inProcessConn = cc
+	return nil
+}
+
+func dialBufconn(lis *bufconn.Listener) (*grpc.ClientConn, error) {
+	return grpc.NewClient(
+		"passthrough:///in-process",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+}
+
+// inProcessCheckTimeout bounds the wait for an in-process connection.
+const inProcessCheckTimeout = 5 * time.Second
+
+// checkBufconn connects cc and waits until it's ready.
+// The in-process connections are insecure, so it fails if the server
+// expects a handshake, i.e. grpc.Creds is passed to WithGRPCOpts.
+func checkBufconn(cc *grpc.ClientConn) error {
+	ctx, cancel := context.WithTimeout(context.Background(), inProcessCheckTimeout)
+	defer cancel()
+	cc.Connect()
+	for {
+		state := cc.GetState()
+		switch state {
+		case connectivity.Ready:
+			return nil
+		case connectivity.TransientFailure:
+			return errors.New("in-process gRPC connection failed; " +
+				"use WithGRPCCreds instead of grpc.Creds in WithGRPCOpts")
+		}
+		if !cc.WaitForStateChange(ctx, state) {
+			return errors.Wrap(ctx.Err(), "in-process gRPC connection isn't ready")
+		}
+	}
+}
+
+// networkCreds applies the credentials to the network connections only,
+// the in-process ones are accepted without the handshake.
+type networkCreds struct {
+	credentials.TransportCredentials
+}
+
+func (c networkCreds) ServerHandshake(conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	if conn.LocalAddr().Network() == "bufconn" {
+		return insecure.NewCredentials().ServerHandshake(conn)
+	}
+	return c.TransportCredentials.ServerHandshake(conn)
+}
+
+func (c networkCreds) Clone() credentials.TransportCredentials {
+	return networkCreds{c.TransportCredentials.Clone()}
+}
+
 func (s *Server) initGRPCServer() error {
-	grpcServer := grpc.NewServer(s.opts.GRPCOpts...)
-	reflection.Register(grpcServer)
+	grpcOpts := append([]grpc.ServerOption(nil), s.opts.GRPCOpts...)
+	unaryInterceptors := s.opts.GRPCUnaryInterceptors
+	streamInterceptors := s.opts.GRPCStreamInterceptors
+	if !s.opts.Deadlines.IsZero() {
+		unaryInterceptors = append(
+			[]grpc.UnaryServerInterceptor{mwgrpc.UnaryDeadline(s.opts.Deadlines)},
+			unaryInterceptors...,
+		)
+		streamInterceptors = append(
+			[]grpc.StreamServerInterceptor{mwgrpc.StreamDeadline(s.opts.Deadlines)},
+			streamInterceptors...,
+		)
+	}
 
+	var unaryMW grpc.UnaryServerInterceptor
+	if len(unaryInterceptors) > 0 {
+		unaryMW = grpc_middleware.ChainUnaryServer(unaryInterceptors...)
+	}
+	var streamMW grpc.StreamServerInterceptor
+	if len(streamInterceptors) > 0 {
+		streamMW = grpc_middleware.ChainStreamServer(streamInterceptors...)
+	}
 	// apply gRPC interceptor
-	if d, ok := s.serviceDesc.(transport.ConfigurableServiceDesc); ok {
-		d.Apply(transport.WithUnaryInterceptor(s.opts.GRPCUnaryInterceptor))
+	if d, ok := s.serviceDesc.(transport.ConfigurableServiceDesc); ok && unaryMW != nil {
+		d.Apply(transport.WithUnaryInterceptor(unaryMW))
+	}
+
+	if s.dynamic != nil {
+		if err := checkCodec(grpcOpts); err != nil {
+			return err
+		}
+		// Servers of the services added at runtime get the same options.
+		s.dynamic.grpcOpts = withInterceptors(grpcOpts, unaryMW, streamMW)
+		s.dynamic.unaryMW = unaryMW
+		unaryMW, streamMW = s.dynamic.unaryGuard(unaryMW), s.dynamic.streamGuard(streamMW)
+		grpcOpts = append(grpcOpts, s.dynamic.serverOptions()...)
+	}
+	grpcOpts = withInterceptors(grpcOpts, unaryMW, streamMW)
+	if s.opts.GRPCCreds != nil {
+		grpcOpts = append(grpcOpts, grpc.Creds(networkCreds{s.opts.GRPCCreds}))
+	}
+
+	grpcServer := grpc.NewServer(grpcOpts...)
+	if s.dynamic != nil {
+		registerReflection(grpcServer, serviceInfoFunc(func() map[string]grpc.ServiceInfo {
+			return s.dynamic.serviceInfo(grpcServer)
+		}))
+	} else {
+		reflection.Register(grpcServer)
 	}
 
-	s.serviceDesc.RegisterGRPC(grpcServer)
+	s.registered = nil
+	for _, desc := range s.descs {
+		s.registered = append(s.registered, registerDescs(grpcServer, desc))
+	}
 	s.grpcServer = grpcServer
+	if s.dynamic != nil {
+		s.dynamic.registerHealth(grpcServer)
+	}
 
 	return nil
 }
+
+// registerReflection registers the reflection service
+// listing the services of the provider.
+func registerReflection(g *grpc.Server, services reflection.ServiceInfoProvider) {
+	opts := reflection.ServerOptions{Services: services}
+	reflectionv1.RegisterServerReflectionServer(g, reflection.NewServerV1(opts))
+	reflectionv1alpha.RegisterServerReflectionServer(g, reflection.NewServer(opts))
+}
+
+// withInterceptors returns the copy of opts with the interceptors set.
+func withInterceptors(opts []grpc.ServerOption, unary grpc.UnaryServerInterceptor, stream grpc.StreamServerInterceptor) []grpc.ServerOption {
+	opts = opts[:len(opts):len(opts)]
+	if stream != nil {
+		opts = append(opts, grpc.StreamInterceptor(stream))
+	}
+	if unary != nil {
+		opts = append(opts, grpc.UnaryInterceptor(unary))
+	}
+	return opts
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+)
+
+// rewriteSpec sets the spec's info and servers set by the DocsOptions.
+// Unless the servers are set, spec's basePath (or OpenAPI's servers' URLs)
+// is rewritten to be served under the prefix.
+func rewriteSpec(def []byte, prefix string, o *DocsOptions) []byte {
+	if prefix == "" && o.Title == "" && o.Version == "" && len(o.Servers) == 0 {
+		return def
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(def, &doc); err != nil {
+		return def
+	}
+
+	if o.Title != "" || o.Version != "" {
+		info, _ := doc["info"].(map[string]interface{})
+		if info == nil {
+			info = map[string]interface{}{}
+		}
+		if o.Title != "" {
+			info["title"] = o.Title
+		}
+		if o.Version != "" {
+			info["version"] = o.Version
+		}
+		doc["info"] = info
+	}
+
+	_, isOpenAPI := doc["openapi"]
+	switch {
+	case len(o.Servers) > 0 && isOpenAPI:
+		servers := make([]interface{}, 0, len(o.Servers))
+		for _, u := range o.Servers {
+			servers = append(servers, map[string]interface{}{"url": u})
+		}
+		doc["servers"] = servers
+	case len(o.Servers) > 0:
+		var schemes []interface{}
+		for i, raw := range o.Servers {
+			u, err := url.Parse(raw)
+			if err != nil {
+				continue
+			}
+			if i == 0 {
+				doc["host"] = u.Host
+				doc["basePath"] = "/" + strings.Trim(u.Path, "/")
+			}
+			if u.Scheme != "" && u.Host == doc["host"] {
+				schemes = append(schemes, u.Scheme)
+			}
+		}
+		if len(schemes) > 0 {
+			doc["schemes"] = schemes
+		}
+	case prefix == "":
+	case isOpenAPI:
+		servers, _ := doc["servers"].([]interface{})
+		for _, srv := range servers {
+			srv, ok := srv.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			raw, _ := srv["url"].(string)
+			u, err := url.Parse(raw)
+			if err != nil {
+				continue
+			}
+			u.Path = prefix + strings.TrimSuffix(u.Path, "/")
+			srv["url"] = u.String()
+		}
+	default:
+		base, _ := doc["basePath"].(string)
+		doc["basePath"] = prefix + strings.TrimSuffix(base, "/")
+	}
+
+	ret, err := json.Marshal(doc)
+	if err != nil {
+		return def
+	}
+	return ret
+}
@@ -0,0 +1,409 @@
+package testing
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/not-for-prod/clay/transport"
+	"github.com/pkg/errors"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// Fixture is the request made over both transports by CheckConformance.
+type Fixture struct {
+	// Name identifies the fixture in the reports, Method is used if empty.
+	Name string
+	// Method is the full gRPC method, i.e. /package.Service/Method.
+	Method string
+	// Request is the method's request.
+	Request proto.Message
+	// Metadata is sent as gRPC metadata and as Grpc-Metadata-* HTTP headers.
+	Metadata metadata.MD
+}
+
+func (f Fixture) name() string {
+	if f.Name != "" {
+		return f.Name
+	}
+	return f.Method
+}
+
+// Difference is the difference between the results of the fixture's
+// gRPC and HTTP calls.
+type Difference struct {
+	Fixture string
+	// Kind is one of "call", "status", "body", "header" or "trailer".
+	Kind string
+	GRPC string
+	HTTP string
+}
+
+func (d Difference) String() string {
+	return fmt.Sprintf("%s: %s differs: gRPC %s, HTTP %s", d.Fixture, d.Kind, d.GRPC, d.HTTP)
+}
+
+// Conform serves the ServiceDesc and reports the differences
+// between the transports' results of the fixtures as the test's errors.
+func Conform(t TB, desc transport.ServiceDesc, fixtures []Fixture, opts ...Option) {
+	t.Helper()
+	env := Start(t, desc, opts...)
+	for _, d := range env.CheckConformance(context.Background(), fixtures...) {
+		t.Errorf("%v", d)
+	}
+}
+
+// CheckConformance calls the unary methods of the fixtures over both gRPC
+// and HTTP and compares the results: response bodies, gRPC codes and
+// their HTTP statuses, header and trailer metadata passed the gateway's
+// default way.
+// HTTP requests are built from the methods' google.api.http bindings.
+func (e *Env) CheckConformance(ctx context.Context, fixtures ...Fixture) []Difference {
+	var ret []Difference
+	for _, f := range fixtures {
+		diffs, err := e.checkFixture(ctx, f)
+		if err != nil {
+			ret = append(ret, Difference{Fixture: f.name(), Kind: "call", GRPC: "-", HTTP: err.Error()})
+			continue
+		}
+		ret = append(ret, diffs...)
+	}
+	return ret
+}
+
+type result struct {
+	st      *status.Status
+	resp    proto.Message
+	header  metadata.MD
+	trailer metadata.MD
+}
+
+func (e *Env) checkFixture(ctx context.Context, f Fixture) ([]Difference, error) {
+	m, ok := transport.LookupMethod(f.Method)
+	if !ok {
+		return nil, errors.Errorf("method %q is not registered", f.Method)
+	}
+	if m.Desc.IsStreamingClient() || m.Desc.IsStreamingServer() {
+		return nil, errors.Errorf("streaming method %q is not supported", f.Method)
+	}
+	rule, ok := proto.GetExtension(m.Options(), annotations.E_Http).(*annotations.HttpRule)
+	if !ok || rule == nil {
+		return nil, errors.Errorf("method %q has no HTTP binding", f.Method)
+	}
+	mt, err := protoregistry.GlobalTypes.FindMessageByName(m.Desc.Output().FullName())
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't find response type")
+	}
+
+	g := e.callGRPC(ctx, f, mt.New().Interface())
+	h, err := e.callHTTP(ctx, f, rule, mt.New().Interface())
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []Difference
+	add := func(kind string, grpcV, httpV interface{}) {
+		ret = append(ret, Difference{Fixture: f.name(), Kind: kind, GRPC: fmt.Sprint(grpcV), HTTP: fmt.Sprint(httpV)})
+	}
+	if g.st.Code() != h.st.Code() || g.st.Message() != h.st.Message() {
+		add("status", g.st.Proto(), h.st.Proto())
+	}
+	if g.st.Code() == codes.OK && h.st.Code() == codes.OK && !proto.Equal(g.resp, h.resp) {
+		add("body", protojson.Format(g.resp), protojson.Format(h.resp))
+	}
+	if gh, hh := userMetadata(g.header), userMetadata(h.header); gh != hh {
+		add("header", gh, hh)
+	}
+	if gt, ht := userMetadata(g.trailer), userMetadata(h.trailer); gt != ht {
+		add("trailer", gt, ht)
+	}
+	return ret, nil
+}
+
+func (e *Env) callGRPC(ctx context.Context, f Fixture, resp proto.Message) result {
+	if len(f.Metadata) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, f.Metadata)
+	}
+	var r result
+	err := e.Conn.Invoke(ctx, f.Method, f.Request, resp, grpc.Header(&r.header), grpc.Trailer(&r.trailer))
+	r.st = status.Convert(err)
+	r.resp = resp
+	return r
+}
+
+func (e *Env) callHTTP(ctx context.Context, f Fixture, rule *annotations.HttpRule, resp proto.Message) (result, error) {
+	req, err := e.newHTTPRequest(ctx, f.Method, rule, f.Request)
+	if err != nil {
+		return result{}, errors.Wrap(err, "couldn't build HTTP request")
+	}
+	for k, vv := range f.Metadata {
+		for _, v := range vv {
+			req.Header.Add(runtime.MetadataHeaderPrefix+k, v)
+		}
+	}
+	// The gateway forwards trailer metadata to the clients accepting trailers only.
+	req.Header.Set("TE", "trailers")
+
+	httpResp, err := e.HTTP.Do(req)
+	if err != nil {
+		return result{}, errors.Wrap(err, "HTTP call failed")
+	}
+	defer httpResp.Body.Close()
+	body, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return result{}, errors.Wrap(err, "couldn't read HTTP response")
+	}
+
+	r := result{
+		resp:    resp,
+		header:  prefixedMetadata(httpResp.Header, runtime.MetadataHeaderPrefix),
+		trailer: prefixedMetadata(httpResp.Trailer, runtime.MetadataTrailerPrefix),
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		st := &spb.Status{}
+		// The body may carry clay's "fields" along with the status.
+		if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(body, st); err != nil {
+			return result{}, errors.Wrapf(err, "couldn't unmarshal HTTP %d error %q", httpResp.StatusCode, body)
+		}
+		r.st = status.FromProto(st)
+		if want := runtime.HTTPStatusFromCode(r.st.Code()); want != httpResp.StatusCode {
+			return result{}, errors.Errorf("HTTP status %d doesn't match code %v, want %d", httpResp.StatusCode, r.st.Code(), want)
+		}
+		return r, nil
+	}
+
+	r.st = status.New(codes.OK, "")
+	target := resp.ProtoReflect()
+	if rule.GetResponseBody() != "" {
+		fd := target.Descriptor().Fields().ByName(protoreflect.Name(rule.GetResponseBody()))
+		if fd == nil || fd.Message() == nil {
+			return result{}, errors.Errorf("unsupported response_body %q", rule.GetResponseBody())
+		}
+		target = target.Mutable(fd).Message()
+	}
+	if err := protojson.Unmarshal(body, target.Interface()); err != nil {
+		return result{}, errors.Wrapf(err, "couldn't unmarshal HTTP response %q", body)
+	}
+	return r, nil
+}
+
+// newHTTPRequest builds the HTTP request of the rule's primary binding:
+// path parameters are substituted, body is marshaled and the rest
+// of the fields are passed in the query.
+func (e *Env) newHTTPRequest(ctx context.Context, fullMethod string, rule *annotations.HttpRule, msg proto.Message) (*http.Request, error) {
+	var method, tmpl string
+	switch p := rule.GetPattern().(type) {
+	case *annotations.HttpRule_Get:
+		method, tmpl = http.MethodGet, p.Get
+	case *annotations.HttpRule_Put:
+		method, tmpl = http.MethodPut, p.Put
+	case *annotations.HttpRule_Post:
+		method, tmpl = http.MethodPost, p.Post
+	case *annotations.HttpRule_Delete:
+		method, tmpl = http.MethodDelete, p.Delete
+	case *annotations.HttpRule_Patch:
+		method, tmpl = http.MethodPatch, p.Patch
+	case *annotations.HttpRule_Custom:
+		method, tmpl = p.Custom.GetKind(), p.Custom.GetPath()
+	default:
+		return nil, errors.New("unsupported HTTP binding")
+	}
+
+	tmpl, err := e.routePath(fullMethod, method, tmpl)
+	if err != nil {
+		return nil, err
+	}
+	rest := proto.Clone(msg)
+	path, err := expandPath(tmpl, rest.ProtoReflect())
+	if err != nil {
+		return nil, err
+	}
+
+	var body io.Reader
+	switch b := rule.GetBody(); b {
+	case "":
+	case "*":
+		buf, err := protojson.Marshal(rest)
+		if err != nil {
+			return nil, err
+		}
+		body, rest = bytes.NewReader(buf), nil
+	default:
+		m := rest.ProtoReflect()
+		fd := m.Descriptor().Fields().ByName(protoreflect.Name(b))
+		if fd == nil || fd.Message() == nil {
+			return nil, errors.Errorf("unsupported body field %q", b)
+		}
+		buf, err := protojson.Marshal(m.Get(fd).Message().Interface())
+		if err != nil {
+			return nil, err
+		}
+		m.Clear(fd)
+		body = bytes.NewReader(buf)
+	}
+
+	q := url.Values{}
+	if rest != nil {
+		queryParams(q, "", rest.ProtoReflect())
+	}
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, e.URL(path), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// routePath returns the path template the binding is served at,
+// with the ServiceDesc's and the server's path prefixes.
+func (e *Env) routePath(fullMethod, method, tmpl string) (string, error) {
+	for _, r := range e.Server.Routes() {
+		if r.FullMethod == fullMethod && r.Method == method && strings.HasSuffix(r.Path, tmpl) {
+			return r.Path, nil
+		}
+	}
+	return "", errors.Errorf("%v %v of %q is not served", method, tmpl, fullMethod)
+}
+
+// expandPath substitutes the template's variables with the message's
+// fields and clears them.
+func expandPath(tmpl string, m protoreflect.Message) (string, error) {
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(tmpl, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(tmpl[start:], '}')
+		if end < 0 {
+			return "", errors.Errorf("bad path template %q", tmpl)
+		}
+		b.WriteString(tmpl[:start])
+		variable := tmpl[start+1 : start+end]
+		tmpl = tmpl[start+end+1:]
+
+		fieldPath, pattern, multiSegment := variable, "", false
+		if i := strings.IndexByte(variable, '='); i >= 0 {
+			fieldPath, pattern = variable[:i], variable[i+1:]
+			multiSegment = strings.Contains(pattern, "/") || strings.Contains(pattern, "**")
+		}
+		v, err := takeField(m, strings.Split(fieldPath, "."))
+		if err != nil {
+			return "", err
+		}
+		if multiSegment {
+			b.WriteString(v)
+		} else {
+			b.WriteString(url.PathEscape(v))
+		}
+	}
+	b.WriteString(tmpl)
+	return b.String(), nil
+}
+
+// takeField returns the scalar field's value and clears it.
+func takeField(m protoreflect.Message, path []string) (string, error) {
+	fd := m.Descriptor().Fields().ByName(protoreflect.Name(path[0]))
+	if fd == nil {
+		return "", errors.Errorf("no field %q in %v", path[0], m.Descriptor().FullName())
+	}
+	if len(path) > 1 {
+		if fd.Message() == nil {
+			return "", errors.Errorf("field %q is not a message", path[0])
+		}
+		return takeField(m.Mutable(fd).Message(), path[1:])
+	}
+	if fd.IsList() || fd.IsMap() || fd.Message() != nil {
+		return "", errors.Errorf("path field %q is not a scalar", path[0])
+	}
+	v := scalarString(fd, m.Get(fd))
+	m.Clear(fd)
+	return v, nil
+}
+
+// queryParams adds the message's set fields to the query.
+func queryParams(q url.Values, prefix string, m protoreflect.Message) {
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		name := prefix + string(fd.Name())
+		switch {
+		case fd.IsMap():
+		case fd.IsList():
+			if fd.Message() == nil {
+				l := v.List()
+				for i := 0; i < l.Len(); i++ {
+					q.Add(name, scalarString(fd, l.Get(i)))
+				}
+			}
+		case fd.Message() != nil:
+			queryParams(q, name+".", v.Message())
+		default:
+			q.Add(name, scalarString(fd, v))
+		}
+		return true
+	})
+}
+
+func scalarString(fd protoreflect.FieldDescriptor, v protoreflect.Value) string {
+	switch fd.Kind() {
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return string(ev.Name())
+		}
+	case protoreflect.BytesKind:
+		return base64.StdEncoding.EncodeToString(v.Bytes())
+	}
+	return v.String()
+}
+
+// prefixedMetadata returns the metadata passed in the headers with the prefix.
+func prefixedMetadata(h http.Header, prefix string) metadata.MD {
+	md := metadata.MD{}
+	canonical := textproto.CanonicalMIMEHeaderKey(prefix)
+	for k, vv := range h {
+		if strings.HasPrefix(k, canonical) {
+			md.Append(strings.TrimPrefix(k, canonical), vv...)
+		}
+	}
+	return md
+}
+
+// userMetadata formats the metadata set by handlers, skipping
+// the transports' own keys.
+func userMetadata(md metadata.MD) string {
+	var keys []string
+	for k := range md {
+		if k == "content-type" || strings.HasPrefix(k, "grpc-") || strings.HasPrefix(k, ":") {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s=%q ", k, md[k])
+	}
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,250 @@
+/*
+Package testing starts clay servers for integration tests.
+
+Start serves the ServiceDescs on an in-memory or ephemeral listener
+and returns the clients of both transports, so the tests can check
+gRPC and HTTP return the same results:
+
+	env := claytesting.Start(t, pb.NewSummatorServiceDesc(impl))
+	resp, err := pb.NewSummatorClient(env.Conn).Sum(ctx, req)
+	...
+	httpResp, err := env.HTTP.Post(env.URL("/v1/example/sum/1"), "application/json", body)
+
+Everything is shut down by the test's cleanup.
+
+CheckConformance and Conform call the methods over both transports
+and report the differences of their results.
+*/
+package testing
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/not-for-prod/clay/server"
+	"github.com/not-for-prod/clay/transport"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// TB is the part of testing.TB used by the package.
+type TB interface {
+	Helper()
+	Cleanup(func())
+	Errorf(format string, args ...interface{})
+	Fatalf(format string, args ...interface{})
+}
+
+const (
+	bufferSize = 1 << 20
+	// readyCheckTimeout bounds each readiness check of the server.
+	readyCheckTimeout = time.Second
+	// inMemoryHost is the host of the in-memory server's URLs.
+	inMemoryHost = "clay.test"
+)
+
+// Option is an optional setting of the test server.
+type Option func(*options)
+
+type options struct {
+	ephemeral    bool
+	serverOpts   []server.Option
+	dialOpts     []grpc.DialOption
+	startTimeout time.Duration
+}
+
+// Ephemeral makes the server listen on the ephemeral port of
+// the loopback interface instead of the in-memory listener.
+func Ephemeral() Option {
+	return func(o *options) {
+		o.ephemeral = true
+	}
+}
+
+// WithServerOptions sets the options of the server.
+func WithServerOptions(opts ...server.Option) Option {
+	return func(o *options) {
+		o.serverOpts = append(o.serverOpts, opts...)
+	}
+}
+
+// WithDialOptions sets the options of the gRPC client connection.
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(o *options) {
+		o.dialOpts = append(o.dialOpts, opts...)
+	}
+}
+
+// WithStartTimeout sets the time the server is given to start, 5s by default.
+func WithStartTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.startTimeout = d
+	}
+}
+
+// Env is the running test server and its clients.
+type Env struct {
+	// Server is the running server.
+	Server *server.Server
+	// Conn is the gRPC connection to the server.
+	Conn *grpc.ClientConn
+	// HTTP is the HTTP client connecting to the server.
+	HTTP *http.Client
+	// BaseURL is the server's URL, i.e. http://127.0.0.1:40123.
+	BaseURL string
+}
+
+// URL returns the server's URL of the path.
+func (e *Env) URL(path string) string {
+	return e.BaseURL + path
+}
+
+// Start serves the ServiceDescs for the test.
+// The test fails if the server can't be started.
+func Start(t TB, desc transport.ServiceDesc, opts ...Option) *Env {
+	t.Helper()
+	o := &options{startTimeout: 5 * time.Second}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	env, err := start(t, desc, o)
+	if err != nil {
+		t.Fatalf("couldn't start clay server: %v", err)
+	}
+	return env
+}
+
+func start(t TB, desc transport.ServiceDesc, o *options) (*Env, error) {
+	var (
+		lis     net.Listener
+		dial    func(ctx context.Context) (net.Conn, error)
+		baseURL string
+	)
+	if o.ephemeral {
+		tcp, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, errors.Wrap(err, "couldn't listen")
+		}
+		addr := tcp.Addr().String()
+		lis, baseURL = tcp, "http://"+addr
+		dial = func(ctx context.Context) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+		}
+	} else {
+		buf := bufconn.Listen(bufferSize)
+		lis, baseURL, dial = buf, "http://"+inMemoryHost, buf.DialContext
+	}
+
+	srv := server.NewServer(0, append(o.serverOpts, server.WithListener(lis))...)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.Run(desc)
+	}()
+
+	cc, err := grpc.NewClient("passthrough:///"+inMemoryHost, append([]grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return dial(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}, o.dialOpts...)...)
+	if err != nil {
+		lis.Close()
+		return nil, errors.Wrap(err, "couldn't create gRPC client")
+	}
+
+	env := &Env{
+		Server: srv,
+		Conn:   cc,
+		HTTP: &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dial(ctx)
+			},
+		}},
+		BaseURL: baseURL,
+	}
+	t.Cleanup(func() {
+		env.HTTP.CloseIdleConnections()
+		cc.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), o.startTimeout)
+		defer cancel()
+		srv.Stop(ctx)
+		lis.Close()
+	})
+
+	if err := env.waitReady(errc, o.startTimeout); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// waitReady waits for the server to serve both gRPC and HTTP requests.
+func (e *Env) waitReady(errc <-chan error, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		select {
+		case err := <-errc:
+			if err == nil {
+				err = errors.New("server stopped")
+			}
+			return errors.Wrap(err, "server stopped")
+		default:
+		}
+		err := e.checkGRPC()
+		if err == nil {
+			err = e.checkHTTP()
+		}
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return errors.Wrap(err, "server is not ready")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// checkGRPC checks the gRPC health of the server. The server is healthy
+// unless the health service is registered and reports otherwise.
+func (e *Env) checkGRPC() error {
+	ctx, cancel := context.WithTimeout(context.Background(), readyCheckTimeout)
+	defer cancel()
+	resp, err := healthpb.NewHealthClient(e.Conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	switch {
+	case status.Code(err) == codes.Unimplemented:
+		return nil
+	case err != nil:
+		return errors.Wrap(err, "gRPC health check failed")
+	case resp.GetStatus() != healthpb.HealthCheckResponse_SERVING:
+		return errors.Errorf("gRPC server is %v", resp.GetStatus())
+	}
+	return nil
+}
+
+// checkHTTP checks the HTTP server responds without a server error.
+// The spec is requested, though it may be disabled or protected,
+// so client errors are fine.
+func (e *Env) checkHTTP() error {
+	ctx, cancel := context.WithTimeout(context.Background(), readyCheckTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, e.URL("/swagger.json"), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := e.HTTP.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "HTTP request failed")
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return errors.Errorf("HTTP server responds %v", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package transport
+
+import (
+	"context"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/not-for-prod/clay/transport/httptransport"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// GatewayServiceDesc is a ServiceDesc of the gRPC service which has
+// grpc-gateway's code generated, but not protoc-gen-goclay's one.
+type GatewayServiceDesc[C any] struct {
+	desc      *grpc.ServiceDesc
+	impl      interface{}
+	register  func(context.Context, *runtime.ServeMux, C) error
+	newClient func(grpc.ClientConnInterface) C
+	swagger   []byte
+	opts      httptransport.DescOptions
+}
+
+// NewGatewayServiceDesc creates the ServiceDesc of the gRPC service
+// implementation. register and newClient are the generated
+// Register<Service>HandlerClient and New<Service>Client functions;
+// swagger is the service's Swagger definition, can be nil.
+//
+// The HTTP handlers are registered with Register<Service>HandlerClient,
+// not Register<Service>HandlerServer: the latter takes the typed
+// <Service>Server and calls its methods directly, so there's no place to
+// apply the ServiceDesc's unary interceptor. The client created by newClient
+// calls the implementation in-process through desc's method handlers
+// and the interceptor instead, like the generated ServiceDescs do.
+func NewGatewayServiceDesc[C any](
+	desc *grpc.ServiceDesc,
+	impl interface{},
+	register func(context.Context, *runtime.ServeMux, C) error,
+	newClient func(grpc.ClientConnInterface) C,
+	swagger []byte,
+) *GatewayServiceDesc[C] {
+	if swagger == nil {
+		swagger = []byte("{}")
+	}
+	return &GatewayServiceDesc[C]{
+		desc:      desc,
+		impl:      impl,
+		register:  register,
+		newClient: newClient,
+		swagger:   swagger,
+	}
+}
+
+// RegisterGRPC implements service registrator interface.
+func (d *GatewayServiceDesc[C]) RegisterGRPC(s *grpc.Server) {
+	s.RegisterService(d.desc, d.impl)
+}
+
+// Apply applies passed options.
+func (d *GatewayServiceDesc[C]) Apply(oo ...DescOption) {
+	for _, o := range oo {
+		o.Apply(&d.opts)
+	}
+}
+
+// SwaggerDef returns the service's Swagger definition.
+func (d *GatewayServiceDesc[C]) SwaggerDef() []byte {
+	return d.swagger
+}
+
+// RegisterHTTP registers this service's HTTP handlers/bindings.
+func (d *GatewayServiceDesc[C]) RegisterHTTP(ctx context.Context, mux *runtime.ServeMux) error {
+	return d.register(ctx, mux, d.newClient(localConn[C]{d: d}))
+}
+
+// RegisterHTTPClient registers this service's HTTP handlers dispatching
+// calls through the gRPC connection. It implements ClientServiceDesc.
+func (d *GatewayServiceDesc[C]) RegisterHTTPClient(ctx context.Context, mux *runtime.ServeMux, cc grpc.ClientConnInterface) error {
+	return d.register(ctx, mux, d.newClient(cc))
+}
+
+// localConn calls the implementation's unary methods in-process.
+type localConn[C any] struct {
+	d *GatewayServiceDesc[C]
+}
+
+func (d *GatewayServiceDesc[C]) methodDesc(fullMethod string) (*grpc.MethodDesc, bool) {
+	name := strings.TrimPrefix(fullMethod, "/"+d.desc.ServiceName+"/")
+	for i := range d.desc.Methods {
+		if d.desc.Methods[i].MethodName == name {
+			return &d.desc.Methods[i], true
+		}
+	}
+	return nil, false
+}
+
+func (d *GatewayServiceDesc[C]) call(ctx context.Context, md *grpc.MethodDesc, in proto.Message) (interface{}, error) {
+	return md.Handler(d.impl, ctx, func(v interface{}) error {
+		proto.Merge(v.(proto.Message), in)
+		return nil
+	}, d.opts.UnaryInterceptor)
+}
+
+// Invoke implements grpc.ClientConnInterface.
+func (c localConn[C]) Invoke(ctx context.Context, method string, args, reply interface{}, opts ...grpc.CallOption) error {
+	md, ok := c.d.methodDesc(method)
+	if !ok {
+		return status.Errorf(codes.Unimplemented, "unknown method %v", method)
+	}
+	ctx, call := NewLocalCall(ctx, method, opts...)
+	resp, err := c.d.call(ctx, md, args.(proto.Message))
+	if err = call.Finish(err); err != nil {
+		return err
+	}
+	// An interceptor may return no response without an error,
+	// the reply is left empty then.
+	if resp != nil {
+		proto.Merge(reply.(proto.Message), resp.(proto.Message))
+	}
+	return nil
+}
+
+// NewStream implements grpc.ClientConnInterface.
+func (c localConn[C]) NewStream(_ context.Context, _ *grpc.StreamDesc, method string, _ ...grpc.CallOption) (grpc.ClientStream, error) {
+	return nil, status.Errorf(codes.Unimplemented, "streaming method %v can't be called in-process", method)
+}
@@ -15,6 +15,11 @@ func NewCompoundServiceDesc(desc ...ServiceDesc) *CompoundServiceDesc {
 	return &CompoundServiceDesc{svc: desc}
 }
 
+// ServiceDescs returns the joined ServiceDescs.
+func (d *CompoundServiceDesc) ServiceDescs() []ServiceDesc {
+	return d.svc
+}
+
 func (d *CompoundServiceDesc) RegisterGRPC(g *grpc.Server) {
 	for _, svc := range d.svc {
 		svc.RegisterGRPC(g)
@@ -30,6 +35,24 @@ func (d *CompoundServiceDesc) RegisterHTTP(ctx context.Context, mux *runtime.Ser
 	return nil
 }
 
+// RegisterHTTPClient registers the HTTP handlers dispatching calls
+// through cc for the ServiceDescs implementing ClientServiceDesc,
+// other ones are registered with RegisterHTTP.
+func (d *CompoundServiceDesc) RegisterHTTPClient(ctx context.Context, mux *runtime.ServeMux, cc grpc.ClientConnInterface) error {
+	for _, svc := range d.svc {
+		var err error
+		if c, ok := svc.(ClientServiceDesc); ok {
+			err = c.RegisterHTTPClient(ctx, mux, cc)
+		} else {
+			err = svc.RegisterHTTP(ctx, mux)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (d *CompoundServiceDesc) SwaggerDef() []byte {
 	j := &swagJoiner{}
 	for _, svc := range d.svc {
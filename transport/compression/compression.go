@@ -0,0 +1,194 @@
+// Package compression provides content codings shared by HTTP and gRPC
+// transports.
+//
+// The codecs are registered as gRPC compressors by RegisterGRPC,
+// so gRPC clients can use grpc.UseCompressor with them.
+// server.WithCompression registers its codecs.
+package compression
+
+import (
+	"compress/gzip"
+	"io"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/grpc/encoding"
+)
+
+// Codec compresses and decompresses the streams of the content coding.
+type Codec interface {
+	// Name is the content coding token, i.e. "gzip".
+	Name() string
+	// NewWriter returns the writer compressing data to w.
+	// Writer must be closed to flush the data.
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	// NewReader returns the reader decompressing data from r.
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+var (
+	// Gzip is the gzip content coding.
+	Gzip Codec = &gzipCodec{}
+	// Zstd is the zstd content coding.
+	Zstd Codec = &zstdCodec{}
+	// Brotli is the br content coding.
+	Brotli Codec = &brotliCodec{}
+)
+
+// DefaultCodecs are the codecs in the order of preference
+// used when none are set.
+var DefaultCodecs = []Codec{Zstd, Brotli, Gzip}
+
+// RegisterGRPC registers the codec as the gRPC compressor, replacing
+// the compressor of the same name registered before, process-wide.
+// It must only be called during initialization time, see encoding.RegisterCompressor.
+func RegisterGRPC(c Codec) {
+	encoding.RegisterCompressor(grpcCompressor{c})
+}
+
+// Lookup returns the codec by its name among the codecs.
+func Lookup(name string, codecs []Codec) (Codec, bool) {
+	for _, c := range codecs {
+		if c.Name() == name {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// grpcCompressor adapts Codec to encoding.Compressor.
+type grpcCompressor struct {
+	c Codec
+}
+
+func (g grpcCompressor) Name() string {
+	return g.c.Name()
+}
+
+func (g grpcCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	return g.c.NewWriter(w)
+}
+
+func (g grpcCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	rc, err := g.c.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return &closeOnEOF{rc: rc}, nil
+}
+
+// closeOnEOF closes the reader after it's read up,
+// since gRPC never closes readers.
+type closeOnEOF struct {
+	rc     io.ReadCloser
+	closed bool
+}
+
+func (r *closeOnEOF) Read(p []byte) (int, error) {
+	if r.closed {
+		return 0, io.EOF
+	}
+	n, err := r.rc.Read(p)
+	if err != nil {
+		r.closed = true
+		r.rc.Close()
+	}
+	return n, err
+}
+
+type gzipCodec struct {
+	writers sync.Pool
+}
+
+func (c *gzipCodec) Name() string {
+	return "gzip"
+}
+
+func (c *gzipCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	if gw, ok := c.writers.Get().(*gzip.Writer); ok {
+		gw.Reset(w)
+		return &pooledWriter{WriteCloser: gw, put: func() { c.writers.Put(gw) }}, nil
+	}
+	gw := gzip.NewWriter(w)
+	return &pooledWriter{WriteCloser: gw, put: func() { c.writers.Put(gw) }}, nil
+}
+
+func (c *gzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+type zstdCodec struct {
+	writers sync.Pool
+}
+
+func (c *zstdCodec) Name() string {
+	return "zstd"
+}
+
+func (c *zstdCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	zw, ok := c.writers.Get().(*zstd.Encoder)
+	if ok {
+		zw.Reset(w)
+	} else {
+		var err error
+		zw, err = zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &pooledWriter{WriteCloser: zw, put: func() { c.writers.Put(zw) }}, nil
+}
+
+func (c *zstdCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return zr.IOReadCloser(), nil
+}
+
+type brotliCodec struct {
+	writers sync.Pool
+}
+
+func (c *brotliCodec) Name() string {
+	return "br"
+}
+
+func (c *brotliCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	bw, ok := c.writers.Get().(*brotli.Writer)
+	if ok {
+		bw.Reset(w)
+	} else {
+		bw = brotli.NewWriterLevel(w, brotli.DefaultCompression)
+	}
+	return &pooledWriter{WriteCloser: bw, put: func() { c.writers.Put(bw) }}, nil
+}
+
+func (c *brotliCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(brotli.NewReader(r)), nil
+}
+
+// pooledWriter returns the writer to the pool after it's closed.
+type pooledWriter struct {
+	io.WriteCloser
+	put func()
+}
+
+func (w *pooledWriter) Close() error {
+	err := w.WriteCloser.Close()
+	if w.put != nil {
+		w.put()
+		w.put = nil
+	}
+	return err
+}
+
+// Flush flushes the pending compressed data, if the writer supports it.
+func (w *pooledWriter) Flush() error {
+	if f, ok := w.WriteCloser.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
@@ -19,3 +19,10 @@ type ServiceDesc interface {
 type ConfigurableServiceDesc interface {
 	Apply(...DescOption)
 }
+
+// ClientServiceDesc is implemented by ServiceDescs that can register
+// HTTP handlers dispatching calls through the gRPC client connection,
+// so the calls are processed by the gRPC server as they are.
+type ClientServiceDesc interface {
+	RegisterHTTPClient(ctx context.Context, mux *runtime.ServeMux, cc grpc.ClientConnInterface) error
+}
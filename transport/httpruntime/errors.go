@@ -2,14 +2,23 @@ package httpruntime
 
 import (
 	"encoding/json"
+	"errors"
+	"math"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"golang.org/x/net/context"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
 )
 
-type errResponse struct {
+// fieldError is the field violation listed in the error body's "fields".
+type fieldError struct {
+	Field string `json:"field"`
 	Error string `json:"error"`
 }
 
@@ -17,19 +26,134 @@ type errResponse struct {
 // You can override that in the runtime.
 var SetError func(context.Context, *http.Request, http.ResponseWriter, error) = DefaultSetError
 
-// DefaultSetError is the default error output.
+// DefaultSetError is the default error output. The body is the same
+// HTTPErrorHandler writes for the gateway's errors: google.rpc.Status
+// marshaled to JSON plus the field violations, see HTTPErrorHandler.
 func DefaultSetError(ctx context.Context, req *http.Request, w http.ResponseWriter, err error) {
-	errCode := http.StatusInternalServerError
-	if grpcErr, ok := err.(interface{ GRPCStatus() *status.Status }); ok {
-		errCode = runtime.HTTPStatusFromCode(grpcErr.GRPCStatus().Code())
+	st := status.Convert(FromContextError(err))
+	const fallback = `{"code":13,"message":"failed to marshal error message"}`
+	buf, mErr := protojson.Marshal(st.Proto())
+	if mErr != nil {
+		buf = []byte(fallback)
 	}
+	SetRetryAfter(w, st.Err())
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(errCode)
-	enc := json.NewEncoder(w)
-	enc.Encode(errResponse{Error: err.Error()})
+	w.WriteHeader(runtime.HTTPStatusFromCode(st.Code()))
+	w.Write(withFields(buf, fieldErrors(st.Err())))
+}
+
+// fieldErrors returns the field violations of err's BadRequest details.
+func fieldErrors(err error) []fieldError {
+	st, ok := status.FromError(err)
+	if !ok {
+		return nil
+	}
+	var ret []fieldError
+	for _, d := range st.Details() {
+		if br, ok := d.(*errdetails.BadRequest); ok {
+			for _, v := range br.GetFieldViolations() {
+				ret = append(ret, fieldError{Field: v.GetField(), Error: v.GetDescription()})
+			}
+		}
+	}
+	return ret
+}
+
+// withFields adds the field violations to the JSON error body
+// as the "fields" list.
+func withFields(body []byte, fields []fieldError) []byte {
+	if len(fields) == 0 {
+		return body
+	}
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return body
+	}
+	doc["fields"], _ = json.Marshal(fields)
+	ret, err := json.Marshal(doc)
+	if err != nil {
+		return body
+	}
+	return ret
+}
+
+// fieldsWriter adds the field violations to the JSON error body
+// written by runtime.DefaultHTTPErrorHandler.
+type fieldsWriter struct {
+	http.ResponseWriter
+	fields []fieldError
+}
+
+func (w *fieldsWriter) Write(buf []byte) (int, error) {
+	if _, err := w.ResponseWriter.Write(withFields(buf, w.fields)); err != nil {
+		return 0, err
+	}
+	return len(buf), nil
+}
+
+// Unwrap is used by http.ResponseController.
+func (w *fieldsWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
 }
 
 // TransformUnmarshalerError is called for every error reported by unmarshaler.
 // It can be used to transform the error returned to the client (embed HTTP code in it,
 // mask text, etc.).
 var TransformUnmarshalerError = func(err error) error { return err }
+
+// HTTPErrorHandler is the gateway's error handler that is used by
+// the server by default. It extends runtime.DefaultHTTPErrorHandler
+// with the Retry-After header set from the error's RetryInfo details,
+// context errors reported with their gRPC codes and, for JSON bodies,
+// the BadRequest details' field violations listed in "fields":
+//
+//	{"code":3, "message":"...", "details":[...], "fields":[{"field":"a", "error":"must be positive"}]}
+func HTTPErrorHandler(
+	ctx context.Context,
+	mux *runtime.ServeMux,
+	marshaler runtime.Marshaler,
+	w http.ResponseWriter,
+	req *http.Request,
+	err error,
+) {
+	err = FromContextError(err)
+	SetRetryAfter(w, err)
+	if fields := fieldErrors(err); len(fields) > 0 && isJSON(marshaler.ContentType(nil)) {
+		w = &fieldsWriter{ResponseWriter: w, fields: fields}
+	}
+	runtime.DefaultHTTPErrorHandler(ctx, mux, marshaler, w, req, err)
+}
+
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == MIMEJSON || strings.HasSuffix(mediaType, "+json"))
+}
+
+// FromContextError converts context errors to gRPC status errors
+// the same way gRPC server does, so DeadlineExceeded is reported
+// with 504 Gateway Timeout.
+// Other errors are returned as is.
+func FromContextError(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return status.FromContextError(err).Err()
+	}
+	return err
+}
+
+// SetRetryAfter sets the Retry-After header if err carries RetryInfo details.
+func SetRetryAfter(w http.ResponseWriter, err error) {
+	st, ok := status.FromError(err)
+	if !ok {
+		return
+	}
+	for _, d := range st.Details() {
+		if ri, ok := d.(*errdetails.RetryInfo); ok && ri.GetRetryDelay() != nil {
+			secs := int64(math.Ceil(ri.GetRetryDelay().AsDuration().Seconds()))
+			w.Header().Set("Retry-After", strconv.FormatInt(secs, 10))
+			return
+		}
+	}
+}
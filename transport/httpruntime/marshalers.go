@@ -0,0 +1,174 @@
+package httpruntime
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+)
+
+// MIME types of the marshalers provided.
+const (
+	MIMEProtobuf = "application/x-protobuf"
+	MIMEJSON     = "application/json"
+	MIMEYAML     = "application/yaml"
+)
+
+// ProtobufMarshaler returns the marshaler of the protobuf binary format
+// reporting contentType as its Content-Type.
+func ProtobufMarshaler(contentType string) runtime.Marshaler {
+	return &protoMarshaler{contentType: contentType}
+}
+
+type protoMarshaler struct {
+	runtime.ProtoMarshaller
+	contentType string
+}
+
+// ContentType implements runtime.Marshaler.
+func (m *protoMarshaler) ContentType(interface{}) string {
+	return m.contentType
+}
+
+// Unmarshal implements runtime.Marshaler.
+// Unlike runtime.ProtoMarshaller it accepts pointers to message fields
+// the gateway decodes request bodies into.
+func (m *protoMarshaler) Unmarshal(data []byte, v interface{}) error {
+	msg, err := protoMessage(v)
+	if err != nil {
+		return err
+	}
+	return proto.Unmarshal(data, msg)
+}
+
+// NewDecoder implements runtime.Marshaler.
+func (m *protoMarshaler) NewDecoder(r io.Reader) runtime.Decoder {
+	return runtime.DecoderFunc(func(v interface{}) error {
+		buf, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		return m.Unmarshal(buf, v)
+	})
+}
+
+// protoMessage returns the message v points to,
+// allocating it if v is a pointer to a nil message field.
+func protoMessage(v interface{}) (proto.Message, error) {
+	if msg, ok := v.(proto.Message); ok {
+		return msg, nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() && rv.Elem().Kind() == reflect.Ptr {
+		if rv.Elem().IsNil() {
+			rv.Elem().Set(reflect.New(rv.Elem().Type().Elem()))
+		}
+		if msg, ok := rv.Elem().Interface().(proto.Message); ok {
+			return msg, nil
+		}
+	}
+	return nil, errors.Errorf("%T is not a proto message", v)
+}
+
+// JSONMarshaler returns the protojson marshaler with the options.
+func JSONMarshaler(mo protojson.MarshalOptions, uo protojson.UnmarshalOptions) runtime.Marshaler {
+	return &runtime.HTTPBodyMarshaler{
+		Marshaler: &runtime.JSONPb{MarshalOptions: mo, UnmarshalOptions: uo},
+	}
+}
+
+// YAMLMarshaler returns the marshaler of YAML documents.
+// Messages are converted to and from YAML via their protojson representation.
+func YAMLMarshaler(mo protojson.MarshalOptions, uo protojson.UnmarshalOptions) runtime.Marshaler {
+	return &yamlMarshaler{json: &runtime.JSONPb{MarshalOptions: mo, UnmarshalOptions: uo}}
+}
+
+type yamlMarshaler struct {
+	json *runtime.JSONPb
+}
+
+// ContentType implements runtime.Marshaler.
+func (m *yamlMarshaler) ContentType(interface{}) string {
+	return MIMEYAML
+}
+
+// Marshal implements runtime.Marshaler.
+func (m *yamlMarshaler) Marshal(v interface{}) ([]byte, error) {
+	buf, err := m.json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	// JSON is YAML already; decode it to the node to keep the fields' order.
+	var node yaml.Node
+	if err := yaml.Unmarshal(buf, &node); err != nil {
+		return nil, errors.Wrap(err, "couldn't convert JSON to YAML")
+	}
+	blockStyle(&node)
+	return yaml.Marshal(&node)
+}
+
+// blockStyle resets the flow and quoted styles of the nodes parsed from JSON.
+// Strings that would be read back as other types stay quoted.
+func blockStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, c := range n.Content {
+		blockStyle(c)
+	}
+}
+
+// Unmarshal implements runtime.Marshaler.
+func (m *yamlMarshaler) Unmarshal(data []byte, v interface{}) error {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	buf, err := json.Marshal(doc)
+	if err != nil {
+		return errors.Wrap(err, "couldn't convert YAML to JSON")
+	}
+	return m.json.Unmarshal(buf, v)
+}
+
+// NewDecoder implements runtime.Marshaler.
+func (m *yamlMarshaler) NewDecoder(r io.Reader) runtime.Decoder {
+	return runtime.DecoderFunc(func(v interface{}) error {
+		buf, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		return m.Unmarshal(buf, v)
+	})
+}
+
+// NewEncoder implements runtime.Marshaler.
+func (m *yamlMarshaler) NewEncoder(w io.Writer) runtime.Encoder {
+	return runtime.EncoderFunc(func(v interface{}) error {
+		buf, err := m.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(buf)
+		return err
+	})
+}
+
+// WriteStatus writes the status in the gateway's JSON error format
+// with the HTTP code. It is used for errors that occur before
+// the gateway's handlers are reached.
+func WriteStatus(w http.ResponseWriter, httpCode int, st *status.Status) {
+	buf, err := protojson.Marshal(st.Proto())
+	if err != nil {
+		buf = []byte(`{"code":13,"message":"failed to marshal error message"}`)
+	}
+	w.Header().Set("Content-Type", MIMEJSON)
+	w.WriteHeader(httpCode)
+	w.Write(bytes.TrimSpace(buf))
+}
@@ -0,0 +1,161 @@
+package httpruntime
+
+import (
+	"context"
+	"net/http"
+	"net/textproto"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+// HeaderRule maps the HTTP header to the gRPC metadata key.
+type HeaderRule struct {
+	// Header is the HTTP header's name.
+	Header string
+	// Key is the metadata key, lowercased Header if empty.
+	Key string
+}
+
+// Header returns the rule passing the header under its own name.
+func Header(name string) HeaderRule {
+	return HeaderRule{Header: name}
+}
+
+func (r HeaderRule) key() string {
+	if r.Key != "" {
+		return strings.ToLower(r.Key)
+	}
+	return strings.ToLower(r.Header)
+}
+
+// CookieRule maps the HTTP cookie to the gRPC metadata key.
+// Attributes are applied to the cookies set from the outgoing metadata.
+type CookieRule struct {
+	// Name is the cookie's name.
+	Name string
+	// Key is the metadata key, lowercased Name if empty.
+	Key string
+
+	Path     string
+	Domain   string
+	MaxAge   int
+	Secure   bool
+	HttpOnly bool
+	SameSite http.SameSite
+}
+
+// Cookie returns the rule passing the cookie under its own name.
+func Cookie(name string) CookieRule {
+	return CookieRule{Name: name}
+}
+
+func (r CookieRule) key() string {
+	if r.Key != "" {
+		return strings.ToLower(r.Key)
+	}
+	return strings.ToLower(r.Name)
+}
+
+// MetadataRules declares how the gateway forwards HTTP headers and cookies
+// to gRPC metadata and the handlers' header metadata back.
+type MetadataRules struct {
+	// IncomingHeaders are the request headers passed as metadata.
+	IncomingHeaders []HeaderRule
+	// IncomingCookies are the request cookies passed as metadata.
+	IncomingCookies []CookieRule
+	// OutgoingHeaders are the header metadata keys written as response headers.
+	OutgoingHeaders []HeaderRule
+	// OutgoingCookies are the header metadata keys written as Set-Cookie
+	// with the rules' attributes on successful responses.
+	// Empty values delete the cookies.
+	OutgoingCookies []CookieRule
+	// Strict drops the headers and metadata not listed,
+	// instead of forwarding them the gateway's default way.
+	Strict bool
+}
+
+// ServeMuxOptions returns the gateway's options applying the rules.
+func (r MetadataRules) ServeMuxOptions() []runtime.ServeMuxOption {
+	var ret []runtime.ServeMuxOption
+	if len(r.IncomingHeaders) > 0 || r.Strict {
+		ret = append(ret, runtime.WithIncomingHeaderMatcher(r.matchIncoming))
+	}
+	if len(r.IncomingCookies) > 0 {
+		ret = append(ret, runtime.WithMetadata(r.incomingCookies))
+	}
+	if len(r.OutgoingHeaders) > 0 || len(r.OutgoingCookies) > 0 || r.Strict {
+		ret = append(ret, runtime.WithOutgoingHeaderMatcher(r.matchOutgoing))
+	}
+	if len(r.OutgoingCookies) > 0 {
+		ret = append(ret, runtime.WithForwardResponseOption(r.setCookies))
+	}
+	return ret
+}
+
+func (r MetadataRules) matchIncoming(header string) (string, bool) {
+	for _, rule := range r.IncomingHeaders {
+		if textproto.CanonicalMIMEHeaderKey(rule.Header) == textproto.CanonicalMIMEHeaderKey(header) {
+			return rule.key(), true
+		}
+	}
+	if r.Strict {
+		return "", false
+	}
+	return runtime.DefaultHeaderMatcher(header)
+}
+
+func (r MetadataRules) incomingCookies(_ context.Context, req *http.Request) metadata.MD {
+	md := metadata.MD{}
+	for _, rule := range r.IncomingCookies {
+		if c, err := req.Cookie(rule.Name); err == nil {
+			md.Append(rule.key(), c.Value)
+		}
+	}
+	return md
+}
+
+func (r MetadataRules) matchOutgoing(key string) (string, bool) {
+	for _, rule := range r.OutgoingCookies {
+		if rule.key() == key {
+			return "", false
+		}
+	}
+	for _, rule := range r.OutgoingHeaders {
+		if rule.key() == key {
+			return rule.Header, true
+		}
+	}
+	if r.Strict {
+		return "", false
+	}
+	return runtime.MetadataHeaderPrefix + key, true
+}
+
+func (r MetadataRules) setCookies(ctx context.Context, w http.ResponseWriter, _ proto.Message) error {
+	md, ok := runtime.ServerMetadataFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	for _, rule := range r.OutgoingCookies {
+		for _, v := range md.HeaderMD.Get(rule.key()) {
+			c := &http.Cookie{
+				Name:     rule.Name,
+				Value:    v,
+				Path:     rule.Path,
+				Domain:   rule.Domain,
+				MaxAge:   rule.MaxAge,
+				Secure:   rule.Secure,
+				HttpOnly: rule.HttpOnly,
+				SameSite: rule.SameSite,
+			}
+			if v == "" {
+				c.MaxAge = -1
+			}
+			http.SetCookie(w, c)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package httptransport
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"google.golang.org/grpc"
+)
+
+// MethodMatcher reports whether a rule applies to the method.
+// fullMethod is the full gRPC method name, i.e. /package.Service/Method.
+type MethodMatcher func(fullMethod string) bool
+
+// MatchMethods returns the MethodMatcher that matches methods against
+// any of the path.Match patterns, i.e. "/package.Service/*" or "/*/Health*".
+// It panics if a pattern is malformed.
+func MatchMethods(patterns ...string) MethodMatcher {
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			panic(fmt.Sprintf("bad method pattern %q: %v", p, err))
+		}
+	}
+	return func(fullMethod string) bool {
+		for _, p := range patterns {
+			if ok, _ := path.Match(p, fullMethod); ok {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// ExceptMethods returns the MethodMatcher that matches every method
+// except the ones matched by MatchMethods(patterns...).
+func ExceptMethods(patterns ...string) MethodMatcher {
+	m := MatchMethods(patterns...)
+	return func(fullMethod string) bool {
+		return !m(fullMethod)
+	}
+}
+
+// SelectUnaryInterceptor returns the interceptor that calls i only for
+// methods matched by m. Other calls are passed to the handler directly.
+func SelectUnaryInterceptor(m MethodMatcher, i grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		if !m(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		return i(ctx, req, info, handler)
+	}
+}
+
+// OptionMethodUnaryInterceptor sets up the gRPC unary interceptor
+// for the methods matched by Matcher.
+type OptionMethodUnaryInterceptor struct {
+	Matcher     MethodMatcher
+	Interceptor grpc.UnaryServerInterceptor
+}
+
+// Apply implements transport.DescOption.
+func (o OptionMethodUnaryInterceptor) Apply(oo *DescOptions) {
+	OptionUnaryInterceptor{
+		Interceptor: SelectUnaryInterceptor(o.Matcher, o.Interceptor),
+	}.Apply(oo)
+}
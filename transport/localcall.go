@@ -0,0 +1,110 @@
+package transport
+
+import (
+	"context"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// LocalCall is the state of a single in-process call made by
+// a generated LocalClient.
+// It emulates the server transport stream so handlers can use
+// grpc.SetHeader/grpc.SetTrailer as they do over the wire.
+type LocalCall struct {
+	method string
+
+	mu         sync.Mutex
+	header     metadata.MD
+	trailer    metadata.MD
+	headerSent bool
+
+	headerAddrs  []*metadata.MD
+	trailerAddrs []*metadata.MD
+}
+
+// NewLocalCall prepares the context for an in-process call of the method.
+// Outgoing metadata of the caller becomes incoming metadata of the handler,
+// grpc.Header and grpc.Trailer call options are collected to be filled
+// by Finish; other call options are ignored.
+func NewLocalCall(ctx context.Context, method string, opts ...grpc.CallOption) (context.Context, *LocalCall) {
+	c := &LocalCall{method: method}
+	for _, o := range opts {
+		switch o := o.(type) {
+		case grpc.HeaderCallOption:
+			c.headerAddrs = append(c.headerAddrs, o.HeaderAddr)
+		case grpc.TrailerCallOption:
+			c.trailerAddrs = append(c.trailerAddrs, o.TrailerAddr)
+		}
+	}
+
+	md, _ := metadata.FromOutgoingContext(ctx)
+	ctx = metadata.NewIncomingContext(ctx, md.Copy())
+	// Handler's outgoing metadata should start empty, just like on the server side.
+	ctx = metadata.NewOutgoingContext(ctx, nil)
+	ctx = grpc.NewContextWithServerTransportStream(ctx, c)
+	return ctx, c
+}
+
+// Finish completes the call: it fills collected header and trailer
+// call options and converts err to the gRPC status error the remote
+// client would have received.
+func (c *LocalCall) Finish(err error) error {
+	c.mu.Lock()
+	for _, addr := range c.headerAddrs {
+		*addr = c.header.Copy()
+	}
+	for _, addr := range c.trailerAddrs {
+		*addr = c.trailer.Copy()
+	}
+	c.mu.Unlock()
+
+	if err == nil {
+		return nil
+	}
+	switch err {
+	case context.Canceled:
+		return status.Error(codes.Canceled, err.Error())
+	case context.DeadlineExceeded:
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+	return status.Convert(err).Err()
+}
+
+// Method implements grpc.ServerTransportStream.
+func (c *LocalCall) Method() string {
+	return c.method
+}
+
+// SetHeader implements grpc.ServerTransportStream.
+func (c *LocalCall) SetHeader(md metadata.MD) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.headerSent {
+		return status.Error(codes.Internal, "transport: header was already sent")
+	}
+	c.header = metadata.Join(c.header, md)
+	return nil
+}
+
+// SendHeader implements grpc.ServerTransportStream.
+func (c *LocalCall) SendHeader(md metadata.MD) error {
+	if err := c.SetHeader(md); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.headerSent = true
+	c.mu.Unlock()
+	return nil
+}
+
+// SetTrailer implements grpc.ServerTransportStream.
+func (c *LocalCall) SetTrailer(md metadata.MD) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.trailer = metadata.Join(c.trailer, md)
+	return nil
+}
@@ -0,0 +1,84 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// MethodInfo describes a registered method.
+type MethodInfo struct {
+	// FullMethod is the full gRPC method name, i.e. /package.Service/Method.
+	FullMethod string
+	// Desc is the method's protobuf descriptor.
+	Desc protoreflect.MethodDescriptor
+}
+
+// Options returns the method's options.
+// Custom options can be read from it via proto.GetExtension.
+func (m *MethodInfo) Options() *descriptorpb.MethodOptions {
+	opts, _ := m.Desc.Options().(*descriptorpb.MethodOptions)
+	if opts == nil {
+		return &descriptorpb.MethodOptions{}
+	}
+	return opts
+}
+
+// HasOption reports whether the custom option xt is set for the method.
+func (m *MethodInfo) HasOption(xt protoreflect.ExtensionType) bool {
+	return proto.HasExtension(m.Options(), xt)
+}
+
+// Option returns the value of the custom option xt,
+// or its default value if the option is not set.
+func (m *MethodInfo) Option(xt protoreflect.ExtensionType) interface{} {
+	return proto.GetExtension(m.Options(), xt)
+}
+
+var methods = struct {
+	sync.RWMutex
+	m map[string]*MethodInfo
+}{m: map[string]*MethodInfo{}}
+
+// RegisterService registers the service's methods to be looked up
+// by LookupMethod and MethodFromContext.
+// It is called by the code generated by protoc-gen-goclay.
+func RegisterService(sd protoreflect.ServiceDescriptor) {
+	methods.Lock()
+	defer methods.Unlock()
+
+	mm := sd.Methods()
+	for i := 0; i < mm.Len(); i++ {
+		md := mm.Get(i)
+		fullMethod := fmt.Sprintf("/%s/%s", sd.FullName(), md.Name())
+		methods.m[fullMethod] = &MethodInfo{FullMethod: fullMethod, Desc: md}
+	}
+}
+
+// LookupMethod returns the registered method by its full name.
+func LookupMethod(fullMethod string) (*MethodInfo, bool) {
+	methods.RLock()
+	defer methods.RUnlock()
+	m, ok := methods.m[fullMethod]
+	return m, ok
+}
+
+// MethodFromContext returns the registered method being called.
+// It works for both gRPC and HTTP handlers' contexts, including
+// the ones passed to interceptors.
+func MethodFromContext(ctx context.Context) (*MethodInfo, bool) {
+	fullMethod, ok := grpc.Method(ctx)
+	if !ok || fullMethod == "" {
+		fullMethod, ok = runtime.RPCMethod(ctx)
+	}
+	if !ok {
+		return nil, false
+	}
+	return LookupMethod(fullMethod)
+}
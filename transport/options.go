@@ -14,3 +14,9 @@ type DescOption interface {
 func WithUnaryInterceptor(i grpc.UnaryServerInterceptor) DescOption {
 	return httptransport.OptionUnaryInterceptor{Interceptor: i}
 }
+
+// WithMethodUnaryInterceptor sets up the interceptor for incoming calls
+// of the methods matched by m, see httptransport.MatchMethods.
+func WithMethodUnaryInterceptor(m httptransport.MethodMatcher, i grpc.UnaryServerInterceptor) DescOption {
+	return httptransport.OptionMethodUnaryInterceptor{Matcher: m, Interceptor: i}
+}
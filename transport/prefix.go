@@ -0,0 +1,100 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+)
+
+// PrefixedServiceDesc is a ServiceDesc whose HTTP routes are served
+// under the path prefix, i.e. the API version.
+type PrefixedServiceDesc struct {
+	desc   ServiceDesc
+	prefix string
+}
+
+// WithPathPrefix returns the ServiceDesc serving desc's HTTP routes
+// under the prefix, i.e. /v1/items/{id} is served at /api/v2/v1/items/{id}
+// with /api/v2 prefix. gRPC services are registered as they are.
+//
+// RegisterHTTP registers the handlers without the prefix,
+// it's up to the server to mount them under PathPrefix.
+func WithPathPrefix(prefix string, desc ServiceDesc) *PrefixedServiceDesc {
+	return &PrefixedServiceDesc{desc: desc, prefix: CleanPathPrefix(prefix)}
+}
+
+// CleanPathPrefix returns the prefix starting with a slash and
+// without the trailing one, i.e. /api/v2. Empty prefix stays empty.
+func CleanPathPrefix(prefix string) string {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return ""
+	}
+	return "/" + prefix
+}
+
+// PathPrefix returns the prefix of the HTTP routes.
+func (d *PrefixedServiceDesc) PathPrefix() string {
+	return d.prefix
+}
+
+// ServiceDesc returns the wrapped ServiceDesc.
+func (d *PrefixedServiceDesc) ServiceDesc() ServiceDesc {
+	return d.desc
+}
+
+// RegisterGRPC implements service registrator interface.
+func (d *PrefixedServiceDesc) RegisterGRPC(s *grpc.Server) {
+	d.desc.RegisterGRPC(s)
+}
+
+// RegisterHTTP registers the wrapped ServiceDesc's HTTP handlers.
+func (d *PrefixedServiceDesc) RegisterHTTP(ctx context.Context, mux *runtime.ServeMux) error {
+	return d.desc.RegisterHTTP(ctx, mux)
+}
+
+// RegisterHTTPClient registers the wrapped ServiceDesc's HTTP handlers
+// dispatching calls through cc if it implements ClientServiceDesc.
+func (d *PrefixedServiceDesc) RegisterHTTPClient(ctx context.Context, mux *runtime.ServeMux, cc grpc.ClientConnInterface) error {
+	if c, ok := d.desc.(ClientServiceDesc); ok {
+		return c.RegisterHTTPClient(ctx, mux, cc)
+	}
+	return d.desc.RegisterHTTP(ctx, mux)
+}
+
+// Apply applies passed options to the wrapped ServiceDesc if it's configurable.
+func (d *PrefixedServiceDesc) Apply(oo ...DescOption) {
+	if c, ok := d.desc.(ConfigurableServiceDesc); ok {
+		c.Apply(oo...)
+	}
+}
+
+// SwaggerDef returns the wrapped ServiceDesc's Swagger definition
+// with the paths prefixed.
+func (d *PrefixedServiceDesc) SwaggerDef() []byte {
+	def := d.desc.SwaggerDef()
+	if d.prefix == "" {
+		return def
+	}
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(def, &doc); err != nil {
+		return def
+	}
+	var paths map[string]json.RawMessage
+	if err := json.Unmarshal(doc["paths"], &paths); err != nil || paths == nil {
+		return def
+	}
+	prefixed := make(map[string]json.RawMessage, len(paths))
+	for p, v := range paths {
+		prefixed[d.prefix+p] = v
+	}
+	doc["paths"], _ = json.Marshal(prefixed)
+	ret, err := json.Marshal(doc)
+	if err != nil {
+		return def
+	}
+	return ret
+}
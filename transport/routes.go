@@ -0,0 +1,319 @@
+package transport
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// Route is an HTTP route served by a ServiceDesc.
+type Route struct {
+	// Method is the HTTP method.
+	Method string `json:"method"`
+	// Path is the path template, i.e. /v1/items/{id}.
+	Path string `json:"path"`
+	// OperationID is the Swagger operation's ID, if set.
+	OperationID string `json:"operationId,omitempty"`
+	// FullMethod is the full gRPC method name, i.e. /package.Service/Method.
+	// It is set for the routes read from the methods' google.api.http options.
+	FullMethod string `json:"rpc,omitempty"`
+	// Body is the request field mapped to the HTTP body, "*" for the whole request.
+	Body string `json:"body,omitempty"`
+	// ResponseBody is the response field mapped to the HTTP body.
+	ResponseBody string `json:"responseBody,omitempty"`
+}
+
+var swaggerMethods = map[string]string{
+	"get":     http.MethodGet,
+	"put":     http.MethodPut,
+	"post":    http.MethodPost,
+	"delete":  http.MethodDelete,
+	"options": http.MethodOptions,
+	"head":    http.MethodHead,
+	"patch":   http.MethodPatch,
+}
+
+// SwaggerRoutes extracts HTTP routes from the Swagger definition.
+// Routes are sorted by path and method.
+func SwaggerRoutes(def []byte) ([]Route, error) {
+	var doc struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(def, &doc); err != nil {
+		return nil, errors.Wrap(err, "couldn't unmarshal JSON def")
+	}
+
+	var ret []Route
+	for path, ops := range doc.Paths {
+		for m, raw := range ops {
+			method, ok := swaggerMethods[strings.ToLower(m)]
+			if !ok {
+				continue
+			}
+			var op struct {
+				OperationID string `json:"operationId"`
+			}
+			_ = json.Unmarshal(raw, &op)
+			ret = append(ret, Route{Method: method, Path: path, OperationID: op.OperationID})
+		}
+	}
+	sortRoutes(ret)
+	return ret, nil
+}
+
+// RouteTable matches request paths against the routes' templates.
+type RouteTable struct {
+	routes []Route
+}
+
+// NewRouteTable creates the RouteTable of the routes.
+func NewRouteTable(routes []Route) *RouteTable {
+	return &RouteTable{routes: routes}
+}
+
+// Routes returns all the routes of the table.
+func (t *RouteTable) Routes() []Route {
+	return t.routes
+}
+
+// Methods returns HTTP methods of the routes matching the path.
+func (t *RouteTable) Methods(path string) []string {
+	var ret []string
+	seen := map[string]bool{}
+	for _, r := range t.routes {
+		if !seen[r.Method] && matchPathTemplate(r.Path, path) {
+			seen[r.Method] = true
+			ret = append(ret, r.Method)
+		}
+	}
+	return ret
+}
+
+// Match returns the route of the request's HTTP method matching the path.
+func (t *RouteTable) Match(method, path string) (Route, bool) {
+	for _, r := range t.routes {
+		if r.Method == method && matchPathTemplate(r.Path, path) {
+			return r, true
+		}
+	}
+	return Route{}, false
+}
+
+// Name returns the name of the route's operation: the full gRPC method
+// name if it's known, or the HTTP method and the path template.
+func (r Route) Name() string {
+	if r.FullMethod != "" {
+		return r.FullMethod
+	}
+	return r.Method + " " + r.Path
+}
+
+// matchPathTemplate reports whether the path matches the template
+// the way the gateway does: parameters match a single segment unless
+// their pattern says otherwise, i.e. {name=shelves/*/books/**},
+// and the template's :verb must be the path's suffix.
+func matchPathTemplate(template, path string) bool {
+	template, verb := splitVerb(template)
+	if verb != "" {
+		if !strings.HasSuffix(path, ":"+verb) {
+			return false
+		}
+		path = strings.TrimSuffix(path, ":"+verb)
+	}
+	return matchSegments(templateSegments(template), strings.Split(strings.Trim(path, "/"), "/"))
+}
+
+// splitVerb splits the template's :verb suffix off.
+func splitVerb(template string) (string, string) {
+	i := strings.LastIndexByte(template, ':')
+	if i < 0 || strings.ContainsAny(template[i:], "/}") {
+		return template, ""
+	}
+	return template[:i], template[i+1:]
+}
+
+// matchSegments reports whether the path's segments match the template's
+// ones, see templateSegments: "*" matches a single segment,
+// "**" matches the rest of the path.
+func matchSegments(template, path []string) bool {
+	for i, s := range template {
+		if s == "**" {
+			return true
+		}
+		if i >= len(path) {
+			return false
+		}
+		switch {
+		case s == "*":
+			if path[i] == "" {
+				return false
+			}
+		case s != path[i]:
+			return false
+		}
+	}
+	return len(template) == len(path)
+}
+
+// DescRoutes returns HTTP routes of the ServiceDesc's gRPC services set by
+// their methods' google.api.http options, prefixed for PrefixedServiceDesc.
+// services are the ones registered by the ServiceDesc, see RegisterGRPC.
+// Methods are looked up by LookupMethod or in protoregistry.GlobalFiles.
+// Routes are sorted by path and method.
+func DescRoutes(desc ServiceDesc, services map[string]grpc.ServiceInfo) ([]Route, error) {
+	if p, ok := desc.(*PrefixedServiceDesc); ok {
+		ret, err := DescRoutes(p.ServiceDesc(), services)
+		for i := range ret {
+			ret[i].Path = p.PathPrefix() + ret[i].Path
+		}
+		return ret, err
+	}
+
+	var ret []Route
+	for svc, info := range services {
+		for _, m := range info.Methods {
+			fullMethod := fmt.Sprintf("/%s/%s", svc, m.Name)
+			md, ok := methodDescriptor(fullMethod)
+			if !ok {
+				continue
+			}
+			bindings, err := methodBindings(md, nil)
+			if err != nil {
+				return nil, err
+			}
+			for _, b := range bindings {
+				r := Route{Method: b.method, Path: b.pattern, FullMethod: fullMethod, Body: b.body}
+				if b.responseBody != nil {
+					r.ResponseBody = string(b.responseBody.Name())
+				}
+				ret = append(ret, r)
+			}
+		}
+	}
+	sortRoutes(ret)
+	return ret, nil
+}
+
+// RegisterGRPC registers the ServiceDesc by the gRPC server
+// and returns the gRPC services it has registered.
+func RegisterGRPC(g *grpc.Server, desc ServiceDesc) map[string]grpc.ServiceInfo {
+	before := g.GetServiceInfo()
+	desc.RegisterGRPC(g)
+	ret := g.GetServiceInfo()
+	for name := range before {
+		delete(ret, name)
+	}
+	return ret
+}
+
+func methodDescriptor(fullMethod string) (protoreflect.MethodDescriptor, bool) {
+	if m, ok := LookupMethod(fullMethod); ok {
+		return m.Desc, true
+	}
+	name := strings.Replace(strings.TrimPrefix(fullMethod, "/"), "/", ".", 1)
+	d, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return nil, false
+	}
+	md, ok := d.(protoreflect.MethodDescriptor)
+	return md, ok
+}
+
+func sortRoutes(rr []Route) {
+	sort.Slice(rr, func(i, j int) bool {
+		if rr[i].Path != rr[j].Path {
+			return rr[i].Path < rr[j].Path
+		}
+		if rr[i].Method != rr[j].Method {
+			return rr[i].Method < rr[j].Method
+		}
+		return rr[i].FullMethod < rr[j].FullMethod
+	})
+}
+
+// RouteConflict is a pair of routes of different ServiceDescs
+// matching the same requests.
+type RouteConflict struct {
+	// Route is the route of the earlier ServiceDesc.
+	Route Route `json:"route"`
+	// By is the route of the later ServiceDesc. Gateway prefers the routes
+	// registered later, so By serves the requests matched by Route.
+	By Route `json:"by"`
+	// Duplicate is true if the routes' templates are the same; otherwise
+	// By's template is more generic and shadows Route completely.
+	Duplicate bool `json:"duplicate"`
+}
+
+func (c RouteConflict) String() string {
+	kind := "shadowed"
+	if c.Duplicate {
+		kind = "duplicated"
+	}
+	return fmt.Sprintf("%v %v (%v) is %v by %v (%v)",
+		c.Route.Method, c.Route.Path, c.Route.FullMethod, kind, c.By.Path, c.By.FullMethod)
+}
+
+// RouteConflicts finds the routes shadowed by the routes of the ServiceDescs
+// registered later. routes are the ServiceDescs' routes in the order
+// of registration, see DescRoutes.
+func RouteConflicts(routes ...[]Route) []RouteConflict {
+	var ret []RouteConflict
+	for i := range routes {
+		for _, r := range routes[i] {
+			rs := templateSegments(r.Path)
+			for j := i + 1; j < len(routes); j++ {
+				for _, by := range routes[j] {
+					if by.Method != r.Method {
+						continue
+					}
+					bs := templateSegments(by.Path)
+					if coversTemplate(bs, rs) {
+						ret = append(ret, RouteConflict{
+							Route:     r,
+							By:        by,
+							Duplicate: strings.Join(rs, "/") == strings.Join(bs, "/"),
+						})
+					}
+				}
+			}
+		}
+	}
+	return ret
+}
+
+// templateSegments splits the path template to segments, parameters are
+// replaced by their patterns, i.e. /v1/{name=shelves/*}/books/{id} becomes
+// [v1 shelves * books *].
+func templateSegments(t string) []string {
+	t = pathParamRe.ReplaceAllStringFunc(t, func(p string) string {
+		if i := strings.IndexByte(p, '='); i >= 0 {
+			return p[i+1 : len(p)-1]
+		}
+		return "*"
+	})
+	return strings.Split(strings.Trim(t, "/"), "/")
+}
+
+// coversTemplate reports whether the template a matches every path
+// matched by the template b.
+func coversTemplate(a, b []string) bool {
+	for i, s := range a {
+		if s == "**" {
+			return true
+		}
+		if i >= len(b) || b[i] == "**" {
+			return false
+		}
+		if s != "*" && s != b[i] {
+			return false
+		}
+	}
+	return len(a) == len(b)
+}
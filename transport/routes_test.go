@@ -0,0 +1,75 @@
+package transport
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestMatchPathTemplate(t *testing.T) {
+	tests := []struct {
+		template string
+		path     string
+		want     bool
+	}{
+		{"/v1/users", "/v1/users", true},
+		{"/v1/users", "/v1/users/", true},
+		{"/v1/users", "/v1/users/42", false},
+		{"/v1/users/{id}", "/v1/users/42", true},
+		{"/v1/users/{id}", "/v1/users/42/admin/delete", false},
+		{"/v1/users/{id}", "/v1/users/", false},
+		{"/v1/users/{id}", "/v1/users", false},
+		{"/v1/users/{id}/posts/{post}", "/v1/users/42/posts/1", true},
+		{"/v1/users/{id}/posts/{post}", "/v1/users/42/comments/1", false},
+		{"/v1/{name=shelves/*}", "/v1/shelves/1", true},
+		{"/v1/{name=shelves/*}", "/v1/shelves/1/books", false},
+		{"/v1/{name=shelves/*}", "/v1/books/1", false},
+		{"/v1/{name=shelves/*}/books", "/v1/shelves/1/books", true},
+		{"/v1/{name=shelves/*/books/*}", "/v1/shelves/1/books/2", true},
+		{"/v1/{name=shelves/*/books/**}", "/v1/shelves/1/books/2/3", true},
+		{"/v1/{name=**}", "/v1/a/b/c", true},
+		{"/v1/{name=**}", "/v2/a", false},
+		{"/v1/items/{id}:cancel", "/v1/items/1:cancel", true},
+		{"/v1/items/{id}:cancel", "/v1/items/1", false},
+		{"/v1/items/{id}:cancel", "/v1/items/1:undo", false},
+		{"/v1/items/{id}:cancel", "/v1/items/1/2:cancel", false},
+		{"/v1/{name=projects/*}:run", "/v1/projects/p:run", true},
+		{"/v1/{name=projects/*}:run", "/v1/projects/p/x:run", false},
+		{"/v1/items:batchGet", "/v1/items:batchGet", true},
+		{"/v1/items:batchGet", "/v1/items", false},
+		{"/", "/", true},
+	}
+	for _, tt := range tests {
+		if got := matchPathTemplate(tt.template, tt.path); got != tt.want {
+			t.Errorf("matchPathTemplate(%q, %q) = %v, want %v", tt.template, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestRouteTableMatch(t *testing.T) {
+	table := NewRouteTable([]Route{
+		{Method: http.MethodGet, Path: "/v1/users/{id}", FullMethod: "/pkg.Users/Get"},
+		{Method: http.MethodDelete, Path: "/v1/users/{id}", FullMethod: "/pkg.Users/Delete"},
+		{Method: http.MethodPost, Path: "/v1/users/{id}:ban", FullMethod: "/pkg.Users/Ban"},
+		{Method: http.MethodGet, Path: "/files/{name=**}"},
+	})
+	tests := []struct {
+		method, path string
+		want         string
+	}{
+		{http.MethodGet, "/v1/users/42", "/pkg.Users/Get"},
+		{http.MethodDelete, "/v1/users/42", "/pkg.Users/Delete"},
+		{http.MethodPost, "/v1/users/42:ban", "/pkg.Users/Ban"},
+		{http.MethodGet, "/files/a/b.txt", "GET /files/{name=**}"},
+		{http.MethodGet, "/v1/users/42/admin/delete", ""},
+		{http.MethodPost, "/v1/users/42", ""},
+	}
+	for _, tt := range tests {
+		r, ok := table.Match(tt.method, tt.path)
+		if got := r.Name(); !ok && tt.want != "" || ok && got != tt.want {
+			t.Errorf("Match(%v, %q) = %q, %v; want %q", tt.method, tt.path, got, ok, tt.want)
+		}
+	}
+	if got := table.Methods("/v1/users/42"); len(got) != 2 {
+		t.Errorf("Methods() = %v, want GET and DELETE", got)
+	}
+}
@@ -0,0 +1,384 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/utilities"
+	"github.com/not-for-prod/clay/transport/httptransport"
+	"github.com/pkg/errors"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// DescriptorServiceDesc is a ServiceDesc of the plain gRPC service
+// that doesn't need generated gateway code: HTTP requests are transcoded
+// at runtime by the google.api.http annotations of the service's
+// protobuf descriptor.
+//
+// Only unary methods are served over HTTP.
+type DescriptorServiceDesc struct {
+	desc     *grpc.ServiceDesc
+	impl     interface{}
+	sd       protoreflect.ServiceDescriptor
+	opts     httptransport.DescOptions
+	bindings []httpBinding
+	swagger  []byte
+}
+
+// NewDescriptorServiceDesc creates the ServiceDesc of the gRPC service
+// implementation. fd is the file descriptor the service is declared in;
+// the service is looked up in protoregistry.GlobalFiles if fd is nil.
+func NewDescriptorServiceDesc(desc *grpc.ServiceDesc, impl interface{}, fd protoreflect.FileDescriptor) (*DescriptorServiceDesc, error) {
+	sd, err := findServiceDescriptor(desc.ServiceName, fd)
+	if err != nil {
+		return nil, err
+	}
+	d := &DescriptorServiceDesc{desc: desc, impl: impl, sd: sd}
+	for i := range desc.Methods {
+		md := sd.Methods().ByName(protoreflect.Name(desc.Methods[i].MethodName))
+		if md == nil {
+			return nil, errors.Errorf("method %v is not found in the %v descriptor", desc.Methods[i].MethodName, sd.FullName())
+		}
+		bb, err := methodBindings(md, &desc.Methods[i])
+		if err != nil {
+			return nil, err
+		}
+		d.bindings = append(d.bindings, bb...)
+	}
+	d.swagger = bindingsSwagger(sd, d.bindings)
+	RegisterService(sd)
+	return d, nil
+}
+
+func findServiceDescriptor(name string, fd protoreflect.FileDescriptor) (protoreflect.ServiceDescriptor, error) {
+	if fd != nil {
+		for i := 0; i < fd.Services().Len(); i++ {
+			if sd := fd.Services().Get(i); string(sd.FullName()) == name {
+				return sd, nil
+			}
+		}
+		return nil, errors.Errorf("service %v is not found in %v", name, fd.Path())
+	}
+	d, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't find service %v", name)
+	}
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, errors.Errorf("%v is not a service", name)
+	}
+	return sd, nil
+}
+
+// RegisterGRPC implements service registrator interface.
+func (d *DescriptorServiceDesc) RegisterGRPC(s *grpc.Server) {
+	s.RegisterService(d.desc, d.impl)
+}
+
+// Apply applies passed options.
+func (d *DescriptorServiceDesc) Apply(oo ...DescOption) {
+	for _, o := range oo {
+		o.Apply(&d.opts)
+	}
+}
+
+// SwaggerDef returns the Swagger definition of the service's HTTP routes.
+// It lists the routes only, without the messages' schemas.
+func (d *DescriptorServiceDesc) SwaggerDef() []byte {
+	return d.swagger
+}
+
+// RegisterHTTP registers the HTTP handlers calling the service
+// implementation through the ServiceDesc's interceptors.
+func (d *DescriptorServiceDesc) RegisterHTTP(ctx context.Context, mux *runtime.ServeMux) error {
+	return d.register(mux, func(ctx context.Context, b *httpBinding, decode func(proto.Message) error) (proto.Message, runtime.ServerMetadata, error) {
+		var (
+			stream runtime.ServerTransportStream
+			md     runtime.ServerMetadata
+		)
+		ctx = grpc.NewContextWithServerTransportStream(ctx, &stream)
+		resp, err := b.handler.Handler(d.impl, ctx, func(v interface{}) error {
+			return decode(v.(proto.Message))
+		}, d.opts.UnaryInterceptor)
+		md.HeaderMD, md.TrailerMD = stream.Header(), stream.Trailer()
+		if err != nil {
+			return nil, md, err
+		}
+		if resp == nil {
+			// An interceptor may return no response without an error.
+			return newMessage(b.desc.Output()), md, nil
+		}
+		return resp.(proto.Message), md, nil
+	}, runtime.AnnotateIncomingContext)
+}
+
+// RegisterHTTPClient registers the HTTP handlers dispatching calls
+// through the gRPC connection. It implements ClientServiceDesc.
+func (d *DescriptorServiceDesc) RegisterHTTPClient(ctx context.Context, mux *runtime.ServeMux, cc grpc.ClientConnInterface) error {
+	return d.register(mux, func(ctx context.Context, b *httpBinding, decode func(proto.Message) error) (proto.Message, runtime.ServerMetadata, error) {
+		var md runtime.ServerMetadata
+		in, out := newMessage(b.desc.Input()), newMessage(b.desc.Output())
+		if err := decode(in); err != nil {
+			return nil, md, err
+		}
+		err := cc.Invoke(ctx, b.fullMethod, in, out, grpc.Header(&md.HeaderMD), grpc.Trailer(&md.TrailerMD))
+		return out, md, err
+	}, runtime.AnnotateContext)
+}
+
+type (
+	callFunc     func(ctx context.Context, b *httpBinding, decode func(proto.Message) error) (proto.Message, runtime.ServerMetadata, error)
+	annotateFunc func(ctx context.Context, mux *runtime.ServeMux, r *http.Request, method string, opts ...runtime.AnnotateContextOption) (context.Context, error)
+)
+
+func (d *DescriptorServiceDesc) register(mux *runtime.ServeMux, call callFunc, annotate annotateFunc) error {
+	for i := range d.bindings {
+		b := &d.bindings[i]
+		err := mux.HandlePath(b.method, b.pattern, func(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+			ctx, cancel := context.WithCancel(r.Context())
+			defer cancel()
+			inbound, outbound := runtime.MarshalerForRequest(mux, r)
+			ctx, err := annotate(ctx, mux, r, b.fullMethod, runtime.WithHTTPPathPattern(b.pattern))
+			if err != nil {
+				runtime.HTTPError(ctx, mux, outbound, w, r, err)
+				return
+			}
+			resp, md, err := call(ctx, b, func(msg proto.Message) error {
+				return b.decode(inbound, r, pathParams, msg)
+			})
+			ctx = runtime.NewServerMetadataContext(ctx, md)
+			if err != nil {
+				runtime.HTTPError(ctx, mux, outbound, w, r, err)
+				return
+			}
+			if b.responseBody != nil {
+				resp = responseBody{Message: resp, field: b.responseBody}
+			}
+			runtime.ForwardResponseMessage(ctx, mux, outbound, w, r, resp, mux.GetForwardResponseOptions()...)
+		})
+		if err != nil {
+			return errors.Wrapf(err, "couldn't register %v %v", b.method, b.pattern)
+		}
+	}
+	return nil
+}
+
+// httpBinding is the HTTP route of the method.
+type httpBinding struct {
+	fullMethod   string
+	desc         protoreflect.MethodDescriptor
+	handler      *grpc.MethodDesc
+	method       string
+	pattern      string
+	body         string
+	responseBody protoreflect.FieldDescriptor
+	// filter excludes the body and path fields from query parameters.
+	filter *utilities.DoubleArray
+}
+
+var pathParamRe = regexp.MustCompile(`{([^}=]+)(=[^}]*)?}`)
+
+// methodBindings returns the method's HTTP routes set
+// by google.api.http option.
+func methodBindings(md protoreflect.MethodDescriptor, handler *grpc.MethodDesc) ([]httpBinding, error) {
+	rule, ok := proto.GetExtension(md.Options(), annotations.E_Http).(*annotations.HttpRule)
+	if !ok || rule == nil {
+		return nil, nil
+	}
+	rules := append([]*annotations.HttpRule{rule}, rule.GetAdditionalBindings()...)
+	ret := make([]httpBinding, 0, len(rules))
+	for _, r := range rules {
+		b := httpBinding{
+			fullMethod: fmt.Sprintf("/%s/%s", md.Parent().FullName(), md.Name()),
+			desc:       md,
+			handler:    handler,
+			body:       r.GetBody(),
+		}
+		switch p := r.GetPattern().(type) {
+		case *annotations.HttpRule_Get:
+			b.method, b.pattern = http.MethodGet, p.Get
+		case *annotations.HttpRule_Put:
+			b.method, b.pattern = http.MethodPut, p.Put
+		case *annotations.HttpRule_Post:
+			b.method, b.pattern = http.MethodPost, p.Post
+		case *annotations.HttpRule_Delete:
+			b.method, b.pattern = http.MethodDelete, p.Delete
+		case *annotations.HttpRule_Patch:
+			b.method, b.pattern = http.MethodPatch, p.Patch
+		case *annotations.HttpRule_Custom:
+			b.method, b.pattern = p.Custom.GetKind(), p.Custom.GetPath()
+		default:
+			return nil, errors.Errorf("method %v has no HTTP pattern", b.fullMethod)
+		}
+		if b.body != "" && b.body != "*" && md.Input().Fields().ByName(protoreflect.Name(b.body)) == nil {
+			return nil, errors.Errorf("method %v: body field %v is not found", b.fullMethod, b.body)
+		}
+		if rb := r.GetResponseBody(); rb != "" {
+			b.responseBody = md.Output().Fields().ByName(protoreflect.Name(rb))
+			if b.responseBody == nil {
+				return nil, errors.Errorf("method %v: response body field %v is not found", b.fullMethod, rb)
+			}
+		}
+		var seqs [][]string
+		if b.body != "" && b.body != "*" {
+			seqs = append(seqs, []string{b.body})
+		}
+		for _, m := range pathParamRe.FindAllStringSubmatch(b.pattern, -1) {
+			seqs = append(seqs, strings.Split(m[1], "."))
+		}
+		b.filter = utilities.NewDoubleArray(seqs)
+		ret = append(ret, b)
+	}
+	return ret, nil
+}
+
+// decode fills the request message from the HTTP request's body,
+// path and query parameters.
+func (b *httpBinding) decode(m runtime.Marshaler, r *http.Request, pathParams map[string]string, msg proto.Message) error {
+	if err := decodeBody(m, r.Body, msg.ProtoReflect(), b.body); err != nil {
+		return status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	for k, v := range pathParams {
+		if err := runtime.PopulateFieldFromPath(msg, k, v); err != nil {
+			return status.Errorf(codes.InvalidArgument, "type mismatch, parameter: %s, error: %v", k, err)
+		}
+	}
+	if b.body == "*" {
+		return nil
+	}
+	if err := r.ParseForm(); err != nil {
+		return status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	if err := runtime.PopulateQueryParameters(msg, r.Form, b.filter); err != nil {
+		return status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	return nil
+}
+
+func decodeBody(m runtime.Marshaler, body io.Reader, msg protoreflect.Message, field string) error {
+	if field == "" || body == nil {
+		return nil
+	}
+	if field == "*" {
+		return ignoreEOF(m.NewDecoder(body).Decode(msg.Interface()))
+	}
+	fd := msg.Descriptor().Fields().ByName(protoreflect.Name(field))
+	if fd.Message() != nil && !fd.IsList() && !fd.IsMap() {
+		return ignoreEOF(m.NewDecoder(body).Decode(msg.Mutable(fd).Message().Interface()))
+	}
+	// Scalar, repeated and map fields are decoded as a part of the message.
+	raw, err := io.ReadAll(body)
+	if err != nil || len(strings.TrimSpace(string(raw))) == 0 {
+		return err
+	}
+	wrapped, err := json.Marshal(map[string]json.RawMessage{fd.JSONName(): raw})
+	if err != nil {
+		return err
+	}
+	return m.Unmarshal(wrapped, msg.Interface())
+}
+
+func ignoreEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
+
+// newMessage creates the message of the registered Go type,
+// or the dynamic one if the type is not linked in.
+func newMessage(md protoreflect.MessageDescriptor) proto.Message {
+	if mt, err := protoregistry.GlobalTypes.FindMessageByName(md.FullName()); err == nil {
+		return mt.New().Interface()
+	}
+	return dynamicpb.NewMessage(md)
+}
+
+// responseBody marshals the response's field set by response_body
+// instead of the whole response.
+type responseBody struct {
+	proto.Message
+	field protoreflect.FieldDescriptor
+}
+
+// XXX_ResponseBody is called by runtime.ForwardResponseMessage.
+func (r responseBody) XXX_ResponseBody() interface{} {
+	return fieldValue(r.field, r.ProtoReflect().Get(r.field))
+}
+
+func fieldValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) interface{} {
+	switch {
+	case fd.IsList():
+		l := v.List()
+		ret := make([]interface{}, l.Len())
+		for i := range ret {
+			ret[i] = singularValue(fd, l.Get(i))
+		}
+		return ret
+	case fd.IsMap():
+		ret := map[string]interface{}{}
+		v.Map().Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+			ret[k.String()] = singularValue(fd.MapValue(), v)
+			return true
+		})
+		return ret
+	}
+	return singularValue(fd, v)
+}
+
+func singularValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) interface{} {
+	if fd.Message() != nil {
+		return v.Message().Interface()
+	}
+	return v.Interface()
+}
+
+// bindingsSwagger returns the Swagger definition listing the routes.
+func bindingsSwagger(sd protoreflect.ServiceDescriptor, bindings []httpBinding) []byte {
+	type operation struct {
+		OperationID string                       `json:"operationId"`
+		Tags        []string                     `json:"tags"`
+		Responses   map[string]map[string]string `json:"responses"`
+	}
+	paths := map[string]map[string]operation{}
+	seen := map[string]int{}
+	for _, b := range bindings {
+		path := pathParamRe.ReplaceAllString(b.pattern, "{$1}")
+		if paths[path] == nil {
+			paths[path] = map[string]operation{}
+		}
+		id := fmt.Sprintf("%s_%s", sd.Name(), b.desc.Name())
+		if seen[id]++; seen[id] > 1 {
+			id += fmt.Sprint(seen[id])
+		}
+		paths[path][strings.ToLower(b.method)] = operation{
+			OperationID: id,
+			Tags:        []string{string(sd.Name())},
+			Responses:   map[string]map[string]string{"200": {"description": "A successful response."}},
+		}
+	}
+	ret, err := json.Marshal(map[string]interface{}{
+		"swagger":  "2.0",
+		"info":     map[string]string{"title": sd.ParentFile().Path(), "version": "version not set"},
+		"consumes": []string{"application/json"},
+		"produces": []string{"application/json"},
+		"paths":    paths,
+	})
+	if err != nil {
+		panic(err)
+	}
+	return ret
+}